@@ -1,28 +1,37 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"log"
 	"log/slog"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/vnxcius/mcpanel-back/internal/alerts"
 	"github.com/vnxcius/mcpanel-back/internal/api/router"
 	"github.com/vnxcius/mcpanel-back/internal/api/ws"
+	"github.com/vnxcius/mcpanel-back/internal/backup"
+	"github.com/vnxcius/mcpanel-back/internal/crash"
 	"github.com/vnxcius/mcpanel-back/internal/db"
 	"github.com/vnxcius/mcpanel-back/internal/logging"
 
 	_ "github.com/lib/pq"
 )
 
+const logsDir = "./logs"
+
 func init() {
-	const logsDir = "./logs"
 	if err := godotenv.Load(); err != nil {
 		log.Fatal("Error loading .env file in main: ", err)
 	}
 
-	logging.SetupLogger(logsDir + "/system.log")
-	logging.SetupModlistChangelog(logsDir + "/modlist-changelog")
+	logging.SetupLogger(logsDir+"/system.log", systemLogOptions())
+	logging.SetupConfigChangelog(logsDir + "/config-changelog")
+	logging.SetupPlayerListChangelog(logsDir + "/playerlist-changelog")
 	slog.Debug("Initialized loggers")
 }
 
@@ -39,6 +48,122 @@ func main() {
 	}
 	slog.Info("Connected to database")
 
-	ws.InitializeManager()
+	if err := db.Migrate(); err != nil {
+		slog.Error("Failed to run database migrations", "error", err)
+	}
+
+	// the mod changelog used to live in daily files
+	if err := logging.ImportModChangelogFiles(logsDir + "/modlist-changelog"); err != nil {
+		slog.Error("Failed to import mod changelog files", "error", err)
+	}
+
+	ctx := context.Background()
+	ws.InitializeManager(ctx)
+	setupAlerts()
+	setupBackups(ctx)
+	go watchCrashes(ctx)
 	router.NewRouter()
 }
+
+func setupAlerts() {
+	err := alerts.InitializeEngine(alerts.Options{
+		OnAlert: func(f alerts.Fire) {
+			payload, _ := json.Marshal(f)
+			ws.Manager.Publish(ws.TopicAlerts, ws.EventAlert, payload)
+		},
+	})
+	if err != nil {
+		slog.Error("Failed to load alert rules", "error", err)
+	}
+	ws.Manager.AddLogListener(alerts.Alerts.HandleEntry)
+}
+
+func watchCrashes(ctx context.Context) {
+	serverDir := os.Getenv("SERVER_PATH")
+	if serverDir == "" {
+		slog.Warn("SERVER_PATH is not set, crash reports won't be collected")
+		return
+	}
+
+	err := crash.Watch(ctx, crash.Options{
+		ServerDir: serverDir,
+		OnCrash: func(r crash.Report) {
+			payload, _ := json.Marshal(r)
+			ws.Manager.Publish(ws.TopicStatus, ws.EventServerCrashed, payload)
+		},
+	})
+	if err != nil {
+		slog.Error("Failed to watch crash reports", "error", err)
+	}
+}
+
+func setupBackups(ctx context.Context) {
+	dir := os.Getenv("BACKUP_PATH")
+	if dir == "" {
+		dir = "./backups"
+	}
+
+	backup.InitializeManager(backup.Options{
+		ServerDir: os.Getenv("SERVER_PATH"),
+		Dir:       dir,
+		Retention: backup.Retention{
+			Hourly: envInt("BACKUP_KEEP_HOURLY", 24),
+			Daily:  envInt("BACKUP_KEEP_DAILY", 7),
+			Weekly: envInt("BACKUP_KEEP_WEEKLY", 4),
+		},
+		Status: ws.Manager.GetStatus,
+		OnProgress: func(p backup.Progress) {
+			payload, _ := json.Marshal(p)
+			ws.Manager.Publish(ws.TopicStatus, ws.EventBackupProgress, payload)
+		},
+	})
+
+	interval, err := time.ParseDuration(os.Getenv("BACKUP_INTERVAL"))
+	if err != nil || interval <= 0 {
+		slog.Info("Scheduled backups disabled")
+		return
+	}
+	go backup.Backups.Schedule(ctx, interval)
+}
+
+/*
+Reads the system log settings. Invalid values fall back to the defaults
+since the logger isn't there yet to complain about them.
+*/
+func systemLogOptions() logging.SystemLogOptions {
+	opts := logging.SystemLogOptions{
+		MaxSize:  int64(envInt("LOG_MAX_SIZE_MB", 20)) << 20,
+		Interval: envDuration("LOG_ROTATE_INTERVAL", 24*time.Hour),
+		MaxAge:   time.Duration(envInt("LOG_MAX_AGE_DAYS", 14)) * 24 * time.Hour,
+		Level:    slog.LevelDebug,
+		Location: time.Local,
+	}
+
+	if level, err := logging.ParseLevel(os.Getenv("LOG_LEVEL")); err == nil {
+		opts.Level = level
+	}
+	if name := os.Getenv("LOG_TIMEZONE"); name != "" {
+		if location, err := time.LoadLocation(name); err == nil {
+			opts.Location = location
+		} else {
+			log.Println("Unknown LOG_TIMEZONE, using local time:", name)
+		}
+	}
+	return opts
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	d, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return d
+}
+
+func envInt(key string, fallback int) int {
+	n, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return n
+}
@@ -0,0 +1,99 @@
+package alerts
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+const discordAlertColor = 0xed4245
+
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+type discordEmbed struct {
+	Title       string         `json:"title"`
+	Description string         `json:"description"`
+	Color       int            `json:"color"`
+	Timestamp   string         `json:"timestamp"`
+	Fields      []discordField `json:"fields"`
+}
+
+func postJSON(url string, body any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	resp, err := httpClient.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+	return nil
+}
+
+type webhookBody struct {
+	Rule    string    `json:"rule"`
+	RuleID  int64     `json:"ruleId"`
+	FiredAt time.Time `json:"firedAt"`
+	Count   int       `json:"count"`
+	Window  int       `json:"window"`
+	Sample  []string  `json:"sample"`
+}
+
+func webhookMessage(r Rule, f Fire) webhookBody {
+	return webhookBody{
+		Rule:    r.Name,
+		RuleID:  r.ID,
+		FiredAt: f.FiredAt,
+		Count:   f.Count,
+		Window:  f.Window,
+		Sample:  f.Sample,
+	}
+}
+
+// Builds a Discord webhook body for a fired alert
+func discordMessage(r Rule, f Fire) map[string]any {
+	occurrences := fmt.Sprintf("%d", f.Count)
+	if r.Window > 0 {
+		occurrences += fmt.Sprintf(" in %s", time.Duration(r.Window)*time.Second)
+	}
+
+	sample := strings.Join(f.Sample, "\n")
+	// embed descriptions are capped at 4096 characters, code fence included
+	if len(sample) > 3900 {
+		cut := 3900
+		for cut > 0 && !utf8.RuneStart(sample[cut]) {
+			cut--
+		}
+		sample = sample[:cut] + "…"
+	}
+
+	return map[string]any{
+		"embeds": []discordEmbed{{
+			Title:       "Alert: " + r.Name,
+			Description: "```\n" + strings.ReplaceAll(sample, "```", "'''") + "\n```",
+			Color:       discordAlertColor,
+			Timestamp:   f.FiredAt.Format(time.RFC3339),
+			Fields: []discordField{
+				{Name: "Occurrences", Value: occurrences, Inline: true},
+			},
+		}},
+	}
+}
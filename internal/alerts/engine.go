@@ -0,0 +1,295 @@
+package alerts
+
+import (
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/vnxcius/mcpanel-back/internal/db"
+	"github.com/vnxcius/mcpanel-back/internal/mclog"
+)
+
+const (
+	// lines of the matching entry kept with a fired alert
+	maxSampleLines = 20
+	// rules without a window would otherwise count forever while cooling down
+	maxTrackedMatches = 10000
+	// fired alerts waiting for delivery, more are dropped
+	maxPendingFires = 100
+)
+
+// Fire is an alert that went off
+type Fire struct {
+	ID        int64     `json:"id"`
+	RuleID    int64     `json:"ruleId"`
+	RuleName  string    `json:"ruleName"`
+	FiredAt   time.Time `json:"firedAt"`
+	Count     int       `json:"count"`
+	Window    int       `json:"window"`
+	Sample    []string  `json:"sample"`
+	Delivered bool      `json:"delivered"`
+	Error     string    `json:"error,omitempty"`
+}
+
+type FirePage struct {
+	Fires      []Fire `json:"fires"`
+	NextCursor int64  `json:"nextCursor,omitempty"`
+}
+
+type Options struct {
+	// OnAlert sends alerts of rules using the websocket action
+	OnAlert func(Fire)
+}
+
+type delivery struct {
+	rule Rule
+	fire Fire
+}
+
+type ruleState struct {
+	rule      Rule
+	matches   []time.Time
+	lastFired time.Time
+}
+
+/*
+Engine checks log entries against the alert rules and fires them. Fired
+alerts are delivered one at a time by a single worker, so a noisy rule
+can't pile up requests.
+*/
+type Engine struct {
+	mu         sync.Mutex
+	rules      []*ruleState
+	opts       Options
+	deliveries chan delivery
+
+	now   func() time.Time
+	store func(Fire) (int64, error)
+}
+
+var Alerts *Engine
+
+func InitializeEngine(opts Options) error {
+	Alerts = newEngine(opts)
+	return Alerts.reload()
+}
+
+func newEngine(opts Options) *Engine {
+	e := &Engine{
+		opts:       opts,
+		deliveries: make(chan delivery, maxPendingFires),
+		now:        time.Now,
+		store:      insertFire,
+	}
+	go e.deliver()
+	return e
+}
+
+// Reads the rules again, keeping the counters of rules that still exist
+func (e *Engine) reload() error {
+	rules, err := listRules()
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	old := map[int64]*ruleState{}
+	for _, s := range e.rules {
+		old[s.rule.ID] = s
+	}
+
+	e.rules = e.rules[:0]
+	for _, r := range rules {
+		state := &ruleState{rule: r}
+		if prev, ok := old[r.ID]; ok && prev.rule.UpdatedAt.Equal(r.UpdatedAt) {
+			state = prev
+		}
+		e.rules = append(e.rules, state)
+	}
+	return nil
+}
+
+func (e *Engine) Rules() ([]Rule, error) {
+	return listRules()
+}
+
+func (e *Engine) CreateRule(r Rule) (Rule, error) {
+	if err := r.Validate(); err != nil {
+		return Rule{}, err
+	}
+	created, err := insertRule(r)
+	if err != nil {
+		return Rule{}, err
+	}
+	return created, e.reload()
+}
+
+func (e *Engine) UpdateRule(r Rule) (Rule, error) {
+	if err := r.Validate(); err != nil {
+		return Rule{}, err
+	}
+	updated, err := updateRule(r)
+	if err != nil {
+		return Rule{}, err
+	}
+	return updated, e.reload()
+}
+
+func (e *Engine) DeleteRule(id int64) error {
+	if err := deleteRule(id); err != nil {
+		return err
+	}
+	return e.reload()
+}
+
+/*
+Checks an entry of the tailed log against every enabled rule. Called for
+each entry, so delivery happens in the background; fires that don't fit
+in the queue are dropped.
+*/
+func (e *Engine) HandleEntry(entry mclog.Entry) {
+	now := e.now()
+
+	e.mu.Lock()
+	var fired []Fire
+	for _, s := range e.rules {
+		if !s.rule.Enabled || !s.rule.match(entry) {
+			continue
+		}
+
+		s.matches = append(s.matches, now)
+		if s.rule.Window > 0 {
+			since := now.Add(-time.Duration(s.rule.Window) * time.Second)
+			for len(s.matches) > 0 && s.matches[0].Before(since) {
+				s.matches = s.matches[1:]
+			}
+		}
+		if len(s.matches) > maxTrackedMatches {
+			s.matches = s.matches[len(s.matches)-maxTrackedMatches:]
+		}
+
+		if len(s.matches) < s.rule.Threshold {
+			continue
+		}
+		if now.Sub(s.lastFired) < time.Duration(s.rule.Cooldown)*time.Second {
+			continue
+		}
+
+		sample := entry.Lines()
+		if len(sample) > maxSampleLines {
+			sample = sample[:maxSampleLines]
+		}
+		fired = append(fired, Fire{
+			RuleID:   s.rule.ID,
+			RuleName: s.rule.Name,
+			FiredAt:  now,
+			Count:    len(s.matches),
+			Window:   s.rule.Window,
+			Sample:   sample,
+		})
+		s.lastFired = now
+		s.matches = nil
+	}
+
+	rules := map[int64]Rule{}
+	for _, s := range e.rules {
+		rules[s.rule.ID] = s.rule
+	}
+	e.mu.Unlock()
+
+	for _, f := range fired {
+		select {
+		case e.deliveries <- delivery{rules[f.RuleID], f}:
+		default:
+			slog.Warn("Alert delivery queue full, dropping alert", "rule", f.RuleName)
+		}
+	}
+}
+
+func (e *Engine) deliver() {
+	for d := range e.deliveries {
+		e.fire(d.rule, d.fire)
+	}
+}
+
+func (e *Engine) fire(r Rule, f Fire) {
+	slog.Warn("Alert fired", "rule", r.Name, "count", f.Count)
+
+	var err error
+	switch r.Action {
+	case ActionWebhook:
+		err = postJSON(r.WebhookURL, webhookMessage(r, f))
+	case ActionDiscord:
+		err = postJSON(r.WebhookURL, discordMessage(r, f))
+	case ActionWebsocket:
+		if e.opts.OnAlert != nil {
+			e.opts.OnAlert(f)
+		}
+	}
+
+	f.Delivered = err == nil
+	if err != nil {
+		f.Error = err.Error()
+		slog.Error("Failed to deliver alert", "rule", r.Name, "error", err)
+	}
+
+	if _, err := e.store(f); err != nil {
+		slog.Error("Failed to store fired alert", "rule", r.Name, "error", err)
+	}
+}
+
+/*
+Returns fired alerts, newest first, optionally for a single rule. cursor
+is the ID of the last alert of the previous page.
+*/
+func (e *Engine) History(ruleID, cursor int64, limit int) (FirePage, error) {
+	query := `SELECT id, rule_id, rule_name, fired_at, count, sample, delivered, error FROM "AlertFire"
+		WHERE ($1 = 0 OR rule_id = $1) AND ($2 = 0 OR id < $2)
+		ORDER BY id DESC LIMIT $3`
+	rows, err := db.DBConn.Query(query, ruleID, cursor, limit+1)
+	if err != nil {
+		return FirePage{}, err
+	}
+	defer rows.Close()
+
+	fires := []Fire{}
+	for rows.Next() {
+		var (
+			f      Fire
+			sample []byte
+		)
+		err := rows.Scan(&f.ID, &f.RuleID, &f.RuleName, &f.FiredAt, &f.Count, &sample, &f.Delivered, &f.Error)
+		if err != nil {
+			return FirePage{}, err
+		}
+		f.Sample = []string{}
+		_ = json.Unmarshal(sample, &f.Sample)
+		fires = append(fires, f)
+	}
+	if err := rows.Err(); err != nil {
+		return FirePage{}, err
+	}
+
+	page := FirePage{Fires: fires}
+	if len(fires) > limit {
+		page.Fires = fires[:limit]
+		page.NextCursor = page.Fires[limit-1].ID
+	}
+	return page, nil
+}
+
+func insertFire(f Fire) (int64, error) {
+	sample, _ := json.Marshal(f.Sample)
+
+	var id int64
+	err := db.DBConn.QueryRow(
+		`INSERT INTO "AlertFire" (rule_id, rule_name, fired_at, count, sample, delivered, error)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id`,
+		f.RuleID, f.RuleName, f.FiredAt, f.Count, string(sample), f.Delivered, f.Error,
+	).Scan(&id)
+	return id, err
+}
@@ -0,0 +1,278 @@
+package alerts
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/vnxcius/mcpanel-back/internal/mclog"
+)
+
+// A webhook endpoint recording the bodies posted to it
+func newWebhook(t *testing.T) (string, <-chan []byte) {
+	t.Helper()
+	bodies := make(chan []byte, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("got %s request with content type %q", r.Method, r.Header.Get("Content-Type"))
+		}
+		body, _ := io.ReadAll(r.Body)
+		bodies <- body
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL, bodies
+}
+
+/*
+Builds an engine with the given rules, a clock the test moves by hand and
+a store that hands stored fires to the test instead of the database.
+*/
+func newTestEngine(t *testing.T, rules ...Rule) (*Engine, *time.Time, <-chan Fire) {
+	t.Helper()
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	stored := make(chan Fire, 10)
+
+	e := newEngine(Options{})
+	e.now = func() time.Time { return now }
+	e.store = func(f Fire) (int64, error) {
+		stored <- f
+		return 1, nil
+	}
+	for i := range rules {
+		r := rules[i]
+		if err := r.Validate(); err != nil {
+			t.Fatalf("invalid rule: %v", err)
+		}
+		e.rules = append(e.rules, &ruleState{rule: r})
+	}
+	return e, &now, stored
+}
+
+func expectFire(t *testing.T, stored <-chan Fire) Fire {
+	t.Helper()
+	select {
+	case f := <-stored:
+		return f
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a fired alert")
+		return Fire{}
+	}
+}
+
+func expectNoFire(t *testing.T, stored <-chan Fire) {
+	t.Helper()
+	select {
+	case f := <-stored:
+		t.Fatalf("got unexpected alert with count %d", f.Count)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func expectBody(t *testing.T, bodies <-chan []byte) []byte {
+	t.Helper()
+	select {
+	case body := <-bodies:
+		return body
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the webhook")
+		return nil
+	}
+}
+
+var crashEntry = mclog.Entry{
+	Level:   "ERROR",
+	Message: "Exception ticking world",
+	Raw:     "[12:00:00] [Server thread/ERROR]: Exception ticking world",
+	Stack:   []string{"java.lang.NullPointerException", "\tat net.minecraft.world.level.Level.tick"},
+}
+
+func TestThresholdWithinWindow(t *testing.T) {
+	e, now, stored := newTestEngine(t, Rule{
+		ID: 1, Name: "ticks", Enabled: true, Pattern: "Exception ticking",
+		Threshold: 3, Window: 60, Action: ActionWebsocket,
+	})
+
+	e.HandleEntry(crashEntry)
+	*now = now.Add(30 * time.Second)
+	e.HandleEntry(crashEntry)
+	expectNoFire(t, stored)
+
+	// the first match left the window, so this is only the second
+	*now = now.Add(31 * time.Second)
+	e.HandleEntry(crashEntry)
+	expectNoFire(t, stored)
+
+	e.HandleEntry(crashEntry)
+	f := expectFire(t, stored)
+	if f.RuleID != 1 || f.Count != 3 || f.Window != 60 || !f.Delivered {
+		t.Fatalf("got fire %+v", f)
+	}
+}
+
+func TestNonMatchingEntriesAreNotCounted(t *testing.T) {
+	e, _, stored := newTestEngine(t, Rule{
+		ID: 1, Name: "errors", Enabled: true, Levels: []string{"error"},
+		Threshold: 1, Action: ActionWebsocket,
+	})
+
+	e.HandleEntry(mclog.Entry{Level: "INFO", Raw: "Done (3.2s)!"})
+	expectNoFire(t, stored)
+
+	e.HandleEntry(crashEntry)
+	expectFire(t, stored)
+}
+
+func TestCooldown(t *testing.T) {
+	e, now, stored := newTestEngine(t, Rule{
+		ID: 1, Name: "ticks", Enabled: true, Pattern: "Exception ticking",
+		Threshold: 1, Cooldown: 300, Action: ActionWebsocket,
+	})
+
+	e.HandleEntry(crashEntry)
+	expectFire(t, stored)
+
+	*now = now.Add(299 * time.Second)
+	e.HandleEntry(crashEntry)
+	expectNoFire(t, stored)
+
+	// matches during the cooldown still count towards the next alert
+	*now = now.Add(time.Second)
+	e.HandleEntry(crashEntry)
+	if f := expectFire(t, stored); f.Count != 2 {
+		t.Fatalf("got count %d, want 2", f.Count)
+	}
+}
+
+func TestDisabledRule(t *testing.T) {
+	e, _, stored := newTestEngine(t, Rule{
+		ID: 1, Name: "ticks", Enabled: false, Pattern: "Exception ticking",
+		Threshold: 1, Action: ActionWebsocket,
+	})
+
+	e.HandleEntry(crashEntry)
+	expectNoFire(t, stored)
+}
+
+func TestWebhookBody(t *testing.T) {
+	url, bodies := newWebhook(t)
+	e, _, stored := newTestEngine(t, Rule{
+		ID: 7, Name: "ticks", Enabled: true, Pattern: "NullPointerException",
+		Threshold: 1, Window: 60, Action: ActionWebhook, WebhookURL: url,
+	})
+
+	e.HandleEntry(crashEntry)
+
+	var body webhookBody
+	if err := json.Unmarshal(expectBody(t, bodies), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Rule != "ticks" || body.RuleID != 7 || body.Count != 1 || body.Window != 60 {
+		t.Fatalf("got body %+v", body)
+	}
+	if strings.Join(body.Sample, "\n") != strings.Join(crashEntry.Lines(), "\n") {
+		t.Fatalf("got sample %q", body.Sample)
+	}
+	if !body.FiredAt.Equal(time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Fatalf("got firedAt %v", body.FiredAt)
+	}
+
+	if f := expectFire(t, stored); !f.Delivered || f.Error != "" {
+		t.Fatalf("got fire %+v", f)
+	}
+}
+
+func TestDiscordBody(t *testing.T) {
+	url, bodies := newWebhook(t)
+	e, _, stored := newTestEngine(t, Rule{
+		ID: 1, Name: "ticks", Enabled: true, Pattern: "Exception ticking",
+		Threshold: 1, Window: 90, Action: ActionDiscord, WebhookURL: url,
+	})
+
+	e.HandleEntry(crashEntry)
+
+	var body struct {
+		Embeds []discordEmbed `json:"embeds"`
+	}
+	if err := json.Unmarshal(expectBody(t, bodies), &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Embeds) != 1 {
+		t.Fatalf("got %d embeds", len(body.Embeds))
+	}
+	embed := body.Embeds[0]
+	if embed.Title != "Alert: ticks" || embed.Color != discordAlertColor {
+		t.Fatalf("got embed %+v", embed)
+	}
+	if !strings.HasPrefix(embed.Description, "```\n") || !strings.Contains(embed.Description, "NullPointerException") {
+		t.Fatalf("got description %q", embed.Description)
+	}
+	if embed.Timestamp != "2024-06-01T12:00:00Z" {
+		t.Fatalf("got timestamp %q", embed.Timestamp)
+	}
+	if len(embed.Fields) != 1 || embed.Fields[0].Value != "1 in 1m30s" {
+		t.Fatalf("got fields %+v", embed.Fields)
+	}
+
+	expectFire(t, stored)
+}
+
+func TestDiscordSampleIsCutOnARune(t *testing.T) {
+	// "é" is two bytes, so byte 3900 falls inside one after the leading "a"
+	sample := "a" + strings.Repeat("é", 2500)
+
+	msg := discordMessage(Rule{Name: "ticks"}, Fire{Count: 1, Sample: []string{sample}})
+	description := msg["embeds"].([]discordEmbed)[0].Description
+	if !utf8.ValidString(description) {
+		t.Fatalf("description is not valid UTF-8: %q", description[len(description)-20:])
+	}
+	if want := "```\na" + strings.Repeat("é", 1949) + "…\n```"; description != want {
+		t.Fatalf("got a %d byte description ending in %q", len(description), description[len(description)-20:])
+	}
+}
+
+func TestFailedDeliveryIsStored(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(srv.Close)
+
+	e, _, stored := newTestEngine(t, Rule{
+		ID: 1, Name: "ticks", Enabled: true, Pattern: "Exception ticking",
+		Threshold: 1, Action: ActionWebhook, WebhookURL: srv.URL,
+	})
+
+	e.HandleEntry(crashEntry)
+	if f := expectFire(t, stored); f.Delivered || !strings.Contains(f.Error, "500") {
+		t.Fatalf("got fire %+v", f)
+	}
+}
+
+func TestFullQueueDropsAlerts(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() { close(release) })
+
+	e, _, _ := newTestEngine(t, Rule{
+		ID: 1, Name: "ticks", Enabled: true, Pattern: "Exception ticking",
+		Threshold: 1, Action: ActionWebhook, WebhookURL: srv.URL,
+	})
+
+	// the worker holds the first delivery while the rest fill the queue
+	e.HandleEntry(crashEntry)
+	time.Sleep(100 * time.Millisecond)
+	for range maxPendingFires + 50 {
+		e.HandleEntry(crashEntry)
+	}
+	if n := len(e.deliveries); n != maxPendingFires {
+		t.Fatalf("got %d queued deliveries, want %d", n, maxPendingFires)
+	}
+}
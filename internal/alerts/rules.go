@@ -0,0 +1,226 @@
+package alerts
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/vnxcius/mcpanel-back/internal/db"
+	"github.com/vnxcius/mcpanel-back/internal/mclog"
+)
+
+type Action string
+
+const (
+	ActionWebhook   Action = "webhook"
+	ActionDiscord   Action = "discord"
+	ActionWebsocket Action = "websocket"
+)
+
+const (
+	maxPatternLength = 512
+	maxWindow        = 24 * 60 * 60
+)
+
+var (
+	ErrNotFound = errors.New("alert rule not found")
+
+	levels = []string{"TRACE", "DEBUG", "INFO", "WARN", "ERROR", "FATAL"}
+)
+
+/*
+Rule fires when log entries match it Threshold times within Window
+seconds. A zero window counts matches since the rule last fired. After
+firing the rule stays quiet for Cooldown seconds. Pattern is a regular
+expression matched against the raw entry including stack traces; Levels
+and Logger match the parsed entry. Empty fields match everything, but a
+rule needs at least one of them.
+*/
+type Rule struct {
+	ID         int64     `json:"id"`
+	Name       string    `json:"name"`
+	Enabled    bool      `json:"enabled"`
+	Pattern    string    `json:"pattern"`
+	Levels     []string  `json:"levels"`
+	Logger     string    `json:"logger"`
+	Threshold  int       `json:"threshold"`
+	Window     int       `json:"window"`
+	Cooldown   int       `json:"cooldown"`
+	Action     Action    `json:"action"`
+	WebhookURL string    `json:"webhookUrl,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+
+	re *regexp.Regexp
+}
+
+// ValidationError describes why a rule can't be saved
+type ValidationError struct {
+	Field   string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+/*
+Checks the rule and compiles its pattern. Levels are upper cased.
+*/
+func (r *Rule) Validate() error {
+	r.Name = strings.TrimSpace(r.Name)
+	if r.Name == "" {
+		return &ValidationError{"name", "is required"}
+	}
+
+	if r.Pattern == "" && len(r.Levels) == 0 && r.Logger == "" {
+		return &ValidationError{"pattern", "a pattern, levels or logger is required"}
+	}
+	if len(r.Pattern) > maxPatternLength {
+		return &ValidationError{"pattern", "is too long"}
+	}
+	r.re = nil
+	if r.Pattern != "" {
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return &ValidationError{"pattern", "is not a valid regular expression"}
+		}
+		r.re = re
+	}
+
+	if r.Levels == nil {
+		r.Levels = []string{}
+	}
+	for i, level := range r.Levels {
+		r.Levels[i] = strings.ToUpper(level)
+		if !slices.Contains(levels, r.Levels[i]) {
+			return &ValidationError{"levels", "unknown level " + level}
+		}
+	}
+
+	if r.Threshold < 1 {
+		return &ValidationError{"threshold", "must be at least 1"}
+	}
+	if r.Window < 0 || r.Window > maxWindow {
+		return &ValidationError{"window", fmt.Sprintf("must be between 0 and %d seconds", maxWindow)}
+	}
+	if r.Cooldown < 0 || r.Cooldown > maxWindow {
+		return &ValidationError{"cooldown", fmt.Sprintf("must be between 0 and %d seconds", maxWindow)}
+	}
+
+	switch r.Action {
+	case ActionWebhook, ActionDiscord:
+		u, err := url.Parse(r.WebhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return &ValidationError{"webhookUrl", "must be an http or https URL"}
+		}
+	case ActionWebsocket:
+		r.WebhookURL = ""
+	default:
+		return &ValidationError{"action", "must be webhook, discord or websocket"}
+	}
+
+	return nil
+}
+
+func (r *Rule) match(e mclog.Entry) bool {
+	if len(r.Levels) > 0 && !slices.Contains(r.Levels, e.Level) {
+		return false
+	}
+	if r.Logger != "" && !strings.Contains(strings.ToLower(e.Logger), strings.ToLower(r.Logger)) {
+		return false
+	}
+	if r.re != nil && !slices.ContainsFunc(e.Lines(), r.re.MatchString) {
+		return false
+	}
+	return true
+}
+
+const ruleColumns = `id, name, enabled, pattern, levels, logger, threshold, window_seconds,
+	cooldown_seconds, action, webhook_url, created_at, updated_at`
+
+func listRules() ([]Rule, error) {
+	rows, err := db.DBConn.Query(`SELECT ` + ruleColumns + ` FROM "AlertRule" ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []Rule{}
+	for rows.Next() {
+		r, err := scanRule(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return rules, rows.Err()
+}
+
+func insertRule(r Rule) (Rule, error) {
+	levels, _ := json.Marshal(r.Levels)
+	return scanRule(db.DBConn.QueryRow(
+		`INSERT INTO "AlertRule"
+			(name, enabled, pattern, levels, logger, threshold, window_seconds, cooldown_seconds, action, webhook_url)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING `+ruleColumns,
+		r.Name, r.Enabled, r.Pattern, string(levels), r.Logger, r.Threshold, r.Window, r.Cooldown,
+		string(r.Action), r.WebhookURL,
+	).Scan)
+}
+
+func updateRule(r Rule) (Rule, error) {
+	levels, _ := json.Marshal(r.Levels)
+	updated, err := scanRule(db.DBConn.QueryRow(
+		`UPDATE "AlertRule" SET
+			name = $2, enabled = $3, pattern = $4, levels = $5, logger = $6, threshold = $7,
+			window_seconds = $8, cooldown_seconds = $9, action = $10, webhook_url = $11, updated_at = now()
+		WHERE id = $1
+		RETURNING `+ruleColumns,
+		r.ID, r.Name, r.Enabled, r.Pattern, string(levels), r.Logger, r.Threshold, r.Window, r.Cooldown,
+		string(r.Action), r.WebhookURL,
+	).Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Rule{}, ErrNotFound
+	}
+	return updated, err
+}
+
+func deleteRule(id int64) error {
+	res, err := db.DBConn.Exec(`DELETE FROM "AlertRule" WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func scanRule(scan func(dest ...any) error) (Rule, error) {
+	var (
+		r      Rule
+		levels []byte
+		action string
+	)
+	err := scan(&r.ID, &r.Name, &r.Enabled, &r.Pattern, &levels, &r.Logger, &r.Threshold, &r.Window,
+		&r.Cooldown, &action, &r.WebhookURL, &r.CreatedAt, &r.UpdatedAt)
+	if err != nil {
+		return Rule{}, err
+	}
+
+	r.Action = Action(action)
+	r.Levels = []string{}
+	_ = json.Unmarshal(levels, &r.Levels)
+	if r.Pattern != "" {
+		// patterns are validated before being stored
+		r.re, _ = regexp.Compile(r.Pattern)
+	}
+	return r, nil
+}
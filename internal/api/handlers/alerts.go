@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vnxcius/mcpanel-back/internal/alerts"
+)
+
+const (
+	defaultAlertHistoryLimit = 50
+	maxAlertHistoryLimit     = 200
+)
+
+func ListAlertRules(c *gin.Context) {
+	rules, err := alerts.Alerts.Rules()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rules": rules})
+}
+
+func CreateAlertRule(c *gin.Context) {
+	rule := alerts.Rule{Enabled: true, Threshold: 1, Cooldown: 300}
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+
+	created, err := alerts.Alerts.CreateRule(rule)
+	if err != nil {
+		alertError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, created)
+}
+
+func UpdateAlertRule(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	var rule alerts.Rule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	rule.ID = id
+
+	updated, err := alerts.Alerts.UpdateRule(rule)
+	if err != nil {
+		alertError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, updated)
+}
+
+func DeleteAlertRule(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	if err := alerts.Alerts.DeleteRule(id); err != nil {
+		alertError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent) // 204
+}
+
+func GetAlertHistory(c *gin.Context) {
+	var ruleID, cursor int64
+	var err error
+
+	if value := c.Query("rule"); value != "" {
+		if ruleID, err = strconv.ParseInt(value, 10, 64); err != nil || ruleID < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid rule"})
+			return
+		}
+	}
+	if value := c.Query("cursor"); value != "" {
+		if cursor, err = strconv.ParseInt(value, 10, 64); err != nil || cursor < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cursor"})
+			return
+		}
+	}
+
+	limit := defaultAlertHistoryLimit
+	if value := c.Query("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxAlertHistoryLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(maxAlertHistoryLimit)})
+			return
+		}
+	}
+
+	page, err := alerts.Alerts.History(ruleID, cursor, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+func alertError(c *gin.Context, err error) {
+	var validationErr *alerts.ValidationError
+
+	switch {
+	case errors.As(err, &validationErr):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "field": validationErr.Field})
+	case errors.Is(err, alerts.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vnxcius/mcpanel-back/internal/backup"
+)
+
+func ListBackups(c *gin.Context) {
+	backups, err := backup.Backups.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"backups": backups, "running": backup.Backups.Busy()})
+}
+
+func CreateBackup(c *gin.Context) {
+	name, err := backup.Backups.Start()
+	if err != nil {
+		backupError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"name": name})
+}
+
+func DownloadBackup(c *gin.Context) {
+	name := c.Param("name")
+	path, err := backup.Backups.Path(name)
+	if err != nil {
+		backupError(c, err)
+		return
+	}
+
+	c.FileAttachment(path, name)
+}
+
+func DeleteBackup(c *gin.Context) {
+	if err := backup.Backups.Delete(c.Param("name")); err != nil {
+		backupError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent) // 204
+}
+
+func RestoreBackup(c *gin.Context) {
+	if err := backup.Backups.Restore(c.Param("name")); err != nil {
+		backupError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Restaurando backup..."})
+}
+
+func backupError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, backup.ErrInvalidName):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, backup.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, backup.ErrBusy), errors.Is(err, backup.ErrServerRunning):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vnxcius/mcpanel-back/internal/logging"
+	"github.com/vnxcius/mcpanel-back/internal/releasenotes"
+)
+
+const (
+	defaultChangelogLimit = 50
+	maxChangelogLimit     = 200
+)
+
+/*
+Reads the changelog filters from the query string. type may be repeated or
+comma separated, from and to accept RFC 3339 times or plain dates. There
+is no actor filter, the changelog is public and actors aren't.
+*/
+func parseModChangeQuery(c *gin.Context) (logging.ModChangeQuery, error) {
+	q := logging.ModChangeQuery{
+		Name:  c.Query("name"),
+		Limit: defaultChangelogLimit,
+	}
+
+	for _, param := range c.QueryArray("type") {
+		for _, t := range strings.Split(param, ",") {
+			changeType := logging.ModChangeType(strings.TrimSpace(t))
+			if !changeType.IsValid() {
+				return q, errors.New("invalid change type: " + t)
+			}
+			q.Types = append(q.Types, changeType)
+		}
+	}
+
+	var err error
+	if q.From, err = parseTimeParam(c.Query("from"), false); err != nil {
+		return q, errors.New("invalid from date")
+	}
+	if q.To, err = parseTimeParam(c.Query("to"), true); err != nil {
+		return q, errors.New("invalid to date")
+	}
+
+	if cursor := c.Query("cursor"); cursor != "" {
+		if q.Cursor, err = strconv.ParseInt(cursor, 10, 64); err != nil || q.Cursor < 1 {
+			return q, errors.New("invalid cursor")
+		}
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		q.Limit, err = strconv.Atoi(limit)
+		if err != nil || q.Limit < 1 || q.Limit > maxChangelogLimit {
+			return q, errors.New("limit must be between 1 and " + strconv.Itoa(maxChangelogLimit))
+		}
+	}
+
+	return q, nil
+}
+
+/*
+Parses an RFC 3339 time or a YYYY-MM-DD date. A plain date used as the end
+of a range covers the whole day.
+*/
+func parseTimeParam(value string, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.ParseInLocation(time.DateOnly, value, time.Local)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	return t, nil
+}
+
+/*
+Exports the changes between from and to as release notes, grouped by day
+and change type. format is one of markdown (default), discord, csv or json.
+*/
+func ExportModsChangelog(c *gin.Context) {
+	from, err := parseTimeParam(c.Query("from"), false)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from date"})
+		return
+	}
+	to, err := parseTimeParam(c.Query("to"), true)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to date"})
+		return
+	}
+
+	format := c.DefaultQuery("format", "markdown")
+	if !slices.Contains([]string{"markdown", "discord", "csv", "json"}, format) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be markdown, discord, csv or json"})
+		return
+	}
+
+	page, err := logging.QueryModChanges(logging.ModChangeQuery{From: from, To: to})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// the query is newest first, folding changes needs them in order
+	slices.Reverse(page.Changes)
+	days := releasenotes.Build(page.Changes, time.Local)
+	title := exportTitle(from, to)
+
+	switch format {
+	case "markdown":
+		c.Data(http.StatusOK, "text/markdown; charset=utf-8", []byte(releasenotes.Markdown(title, days)))
+	case "discord":
+		c.JSON(http.StatusOK, releasenotes.Discord(title, days))
+	case "csv":
+		var buf bytes.Buffer
+		if err := releasenotes.CSV(&buf, days); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Header("Content-Disposition", `attachment; filename="modlist-changes.csv"`)
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+	case "json":
+		c.JSON(http.StatusOK, gin.H{"title": title, "days": days})
+	}
+}
+
+func exportTitle(from, to time.Time) string {
+	switch {
+	case !from.IsZero() && !to.IsZero():
+		return "Modlist changes " + from.Format(time.DateOnly) + " – " + to.Format(time.DateOnly)
+	case !from.IsZero():
+		return "Modlist changes since " + from.Format(time.DateOnly)
+	case !to.IsZero():
+		return "Modlist changes until " + to.Format(time.DateOnly)
+	default:
+		return "Modlist changes"
+	}
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vnxcius/mcpanel-back/internal/api/middleware"
+	"github.com/vnxcius/mcpanel-back/internal/api/ws"
+	"github.com/vnxcius/mcpanel-back/internal/configs"
+	"github.com/vnxcius/mcpanel-back/internal/logging"
+	"github.com/vnxcius/mcpanel-back/internal/utils"
+)
+
+type saveConfigRequest struct {
+	Content string `json:"content"`
+	Hash    string `json:"hash" binding:"required"`
+}
+
+type undoConfigRequest struct {
+	Hash string `json:"hash" binding:"required"`
+}
+
+func ListConfigs(c *gin.Context) {
+	files, err := configStore.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"roots": configStore.Roots(), "files": files})
+}
+
+func GetConfigFile(c *gin.Context) {
+	content, err := configStore.Read(c.Query("path"))
+	if err != nil {
+		configError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, content)
+}
+
+func SaveConfigFile(c *gin.Context) {
+	var req saveConfigRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+
+	content, oldHash, err := configStore.Write(c.Query("path"), []byte(req.Content), req.Hash)
+	if err != nil {
+		configError(c, err)
+		return
+	}
+
+	notifyConfigChange(c, content, oldHash, logging.ConfigEdited)
+	c.JSON(http.StatusOK, content)
+}
+
+func UndoConfigFile(c *gin.Context) {
+	var req undoConfigRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+
+	content, oldHash, err := configStore.Undo(c.Query("path"), req.Hash)
+	if err != nil {
+		configError(c, err)
+		return
+	}
+
+	notifyConfigChange(c, content, oldHash, logging.ConfigReverted)
+	c.JSON(http.StatusOK, content)
+}
+
+func GetConfigsChangelog(c *gin.Context) {
+	changes, err := utils.GetConfigChangelog()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"changes": changes})
+}
+
+func notifyConfigChange(
+	c *gin.Context,
+	content configs.Content,
+	oldHash string,
+	changeType logging.ConfigChangeType,
+) {
+	change := logging.LogConfigChange(logging.ConfigChangeEntry{
+		Type:    changeType,
+		Path:    content.Path,
+		OldHash: oldHash,
+		NewHash: content.Hash,
+		Actor:   middleware.GetActor(c),
+		IP:      c.ClientIP(),
+	})
+
+	payload, err := json.Marshal(change)
+	if err != nil {
+		return
+	}
+	ws.Manager.Publish(ws.TopicConfig, ws.EventConfigChanged, payload)
+}
+
+func configError(c *gin.Context, err error) {
+	var validationErr *configs.ValidationError
+
+	switch {
+	case errors.Is(err, configs.ErrInvalidPath), errors.Is(err, configs.ErrUnsupported):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, configs.ErrNotFound), errors.Is(err, configs.ErrNoPrevious):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, configs.ErrHashMismatch):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.As(err, &validationErr):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -1,26 +1,33 @@
 package handlers
 
 import (
-	"bufio"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"log"
 	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
-	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	"github.com/vnxcius/mcpanel-back/internal/api/middleware"
 	"github.com/vnxcius/mcpanel-back/internal/api/ws"
+	"github.com/vnxcius/mcpanel-back/internal/configs"
 	"github.com/vnxcius/mcpanel-back/internal/logging"
+	"github.com/vnxcius/mcpanel-back/internal/players"
 	"github.com/vnxcius/mcpanel-back/internal/utils"
 )
 
 var (
-	modsDir string
+	modsDir   string
+	serverDir string
+	logsPath  string
+
+	configStore *configs.Store
+	playerLists *players.Lists
 )
 
 func init() {
@@ -29,9 +36,66 @@ func init() {
 	}
 
 	modsDir = os.Getenv("MODS_PATH")
+	serverDir = os.Getenv("SERVER_PATH")
+	logsPath = os.Getenv("LOGS_PATH")
+
+	historyDir := os.Getenv("CONFIG_HISTORY_PATH")
+	if historyDir == "" {
+		historyDir = "./data/config-history"
+	}
+	configStore = configs.NewStore(serverDir, historyDir)
+	playerLists = players.NewLists(serverDir, func() string {
+		return ws.Manager.GetStatus()
+	})
 }
 
+/*
+Opens a websocket. Connections with a valid ?otp= ticket are authenticated
+and may control the server, the others only watch it. ?topics= picks the
+topics to start with, all of them by default, and ?protocol= the protocol
+versions the client speaks. Reconnecting clients pass the seq of the last
+event they got as ?since= and the next log position they expect as
+?position=. Frames are JSON unless the client asks for the mcpanel.msgpack
+or mcpanel.cbor subprotocol.
+*/
 func ServeWebSocket(c *gin.Context) {
+	topics, err := ws.ParseTopics(c.Query("topics"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	protocol, err := ws.NegotiateProtocol(c.Query("protocol"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "supported": ws.SupportedProtocols})
+		return
+	}
+
+	// a reconnecting client only gets what it missed
+	opts := ws.ClientOptions{IP: c.ClientIP(), Topics: topics, Protocol: protocol}
+	if since := c.Query("since"); since != "" {
+		if opts.Since, err = strconv.ParseUint(since, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid since"})
+			return
+		}
+	}
+	if position := c.Query("position"); position != "" {
+		if opts.Position, err = strconv.Atoi(position); err != nil || opts.Position < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid position"})
+			return
+		}
+	}
+
+	// redeemed last so a bad request doesn't waste the ticket
+	if ticket := c.Query("otp"); ticket != "" {
+		redeemed, ok := ws.Manager.RedeemTicket(ticket)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired ticket"})
+			return
+		}
+		opts.Actor, opts.Session = &redeemed.Actor, redeemed.Session
+	}
+
 	conn, err := ws.WebsocketUpgrader.Upgrade(c.Writer, c.Request, nil)
 
 	if err != nil {
@@ -39,9 +103,65 @@ func ServeWebSocket(c *gin.Context) {
 		return
 	}
 
-	ip := c.ClientIP()
-	ws.Manager.AddClient(conn, ip)
-	slog.Info("WebSocket client connected", "ip", ip)
+	ws.Manager.AddClient(conn, opts)
+	slog.Info("WebSocket client connected", "ip", opts.IP, "authenticated", opts.Actor != nil, "since", opts.Since, "protocol", protocol)
+}
+
+/*
+Streams the websocket events as server-sent events, for clients that only
+need to watch. Takes the same ?topics= and ?otp= as the websocket, the
+ticket adding the console. A reconnecting EventSource resumes from its
+Last-Event-ID, also accepted as ?lastEventId=.
+*/
+func StreamEvents(c *gin.Context) {
+	topics, err := ws.ParseTopics(c.Query("topics"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	opts := ws.ClientOptions{IP: c.ClientIP(), Topics: topics}
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("lastEventId")
+	}
+	if opts.Since, opts.Position, err = ws.ParseLastEventID(lastEventID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if ticket := c.Query("otp"); ticket != "" {
+		redeemed, ok := ws.Manager.RedeemTicket(ticket)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired ticket"})
+			return
+		}
+		opts.Actor, opts.Session = &redeemed.Actor, redeemed.Session
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	slog.Info("Event stream client connected", "ip", opts.IP, "authenticated", opts.Actor != nil, "since", opts.Since)
+	if err := ws.Manager.Stream(c.Request.Context(), c.Writer, c.Writer.Flush, opts); err != nil {
+		slog.Debug("Event stream closed", "ip", opts.IP, "error", err)
+	}
+}
+
+/*
+Issues a one-time ticket for opening an authenticated websocket as the
+caller's session.
+*/
+func IssueWebSocketTicket(c *gin.Context) {
+	ticket := ws.Manager.IssueTicket(*middleware.GetActor(c), middleware.GetSession(c))
+	c.JSON(http.StatusCreated, ticket)
+}
+
+func GetWebSocketTopics(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"topics": ws.Manager.TopicStats()})
 }
 
 func GetModlist(c *gin.Context) {
@@ -82,15 +202,16 @@ func UploadMods(c *gin.Context) {
 	}
 
 	for _, uploadedMod := range uploaded {
-		change := logging.LogModChange(uploadedMod, logging.ModAdded)
-
-		payload, err := json.Marshal(change)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
+		change := logging.LogModChange(logging.ModChangeEntry{
+			Type:    logging.ModAdded,
+			Name:    filepath.Base(uploadedMod),
+			Actor:   middleware.GetActor(c),
+			IP:      c.ClientIP(),
+			New:     modFile(uploadedMod),
+			Comment: c.PostForm("comment"),
+		})
 
-		ws.Manager.UpdateModlist(ws.EventModAdded, payload)
+		ws.Manager.UpdateModlist(ws.EventModAdded, change)
 	}
 
 	c.JSON(http.StatusCreated, gin.H{
@@ -114,23 +235,25 @@ func UpdateMod(c *gin.Context) {
 		return
 	}
 
+	// read before the old jar is gone
+	oldMod := modFile(oldModBase)
+
 	if err := utils.UpdateModFromDir(file, modsDir, oldModBase, c); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	change := logging.LogModChange(
-		fmt.Sprintf("%s → %s", oldModBase, file.Filename),
-		logging.ModUpdated,
-	)
-
-	payload, err := json.Marshal(change)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
+	change := logging.LogModChange(logging.ModChangeEntry{
+		Type:    logging.ModUpdated,
+		Name:    filepath.Base(file.Filename),
+		Actor:   middleware.GetActor(c),
+		IP:      c.ClientIP(),
+		Old:     oldMod,
+		New:     modFile(file.Filename),
+		Comment: c.PostForm("comment"),
+	})
 
-	ws.Manager.UpdateModlist(ws.EventModUpdated, payload)
+	ws.Manager.UpdateModlist(ws.EventModUpdated, change)
 	c.Status(http.StatusNoContent) // 204
 }
 
@@ -143,21 +266,37 @@ func DeleteMod(c *gin.Context) {
 		return
 	}
 
+	oldMod := modFile(modName)
+
 	if err := utils.DeleteModFromDir(modsDir, modName); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	change := logging.LogModChange(modName, logging.ModDeleted)
+	change := logging.LogModChange(logging.ModChangeEntry{
+		Type:    logging.ModDeleted,
+		Name:    modName,
+		Actor:   middleware.GetActor(c),
+		IP:      c.ClientIP(),
+		Old:     oldMod,
+		Comment: c.Query("comment"),
+	})
+
+	ws.Manager.UpdateModlist(ws.EventModDeleted, change)
+	c.Status(http.StatusNoContent) // 204
+}
 
-	payload, err := json.Marshal(change)
+/*
+Describes a jar in the mods folder for the changelog. Falls back to just
+the name if the file can't be read.
+*/
+func modFile(name string) *logging.ModFile {
+	info, err := utils.ReadModFile(filepath.Join(modsDir, filepath.Base(name)))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+		slog.Warn("Failed to read mod file details", "name", name, "error", err)
+		return &logging.ModFile{Name: filepath.Base(name)}
 	}
-
-	ws.Manager.UpdateModlist(ws.EventModDeleted, payload)
-	c.Status(http.StatusNoContent) // 204
+	return &info
 }
 
 func DownloadMod(c *gin.Context) {
@@ -177,42 +316,24 @@ func DownloadMod(c *gin.Context) {
 }
 
 func GetModsChangelog(c *gin.Context) {
-	const logDir = "./logs/modlist-changelog"
-
-	files, err := os.ReadDir(logDir)
+	query, err := parseModChangeQuery(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read changelog dir"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	sort.Slice(files, func(i, j int) bool {
-		return files[i].Name() < files[j].Name()
-	})
-
-	var allChanges []map[string]any
-
-	for _, file := range files {
-		if file.IsDir() || !strings.HasSuffix(file.Name(), ".log") {
-			continue
-		}
-
-		path := filepath.Join(logDir, file.Name())
-		f, err := os.Open(path)
-		if err != nil {
-			continue
-		}
+	page, err := logging.QueryModChanges(query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
-		scanner := bufio.NewScanner(f)
-		for scanner.Scan() {
-			var entry map[string]any
-			if err := json.Unmarshal([]byte(scanner.Text()), &entry); err == nil {
-				allChanges = append(allChanges, entry)
-			}
-		}
-		f.Close()
+	// this endpoint is public, keep who made the changes out of it
+	for i := range page.Changes {
+		page.Changes[i] = page.Changes[i].Redacted()
 	}
 
-	c.JSON(http.StatusOK, gin.H{"changes": allChanges})
+	c.JSON(http.StatusOK, page)
 }
 
 func GetServerStatus(c *gin.Context) {
@@ -220,28 +341,25 @@ func GetServerStatus(c *gin.Context) {
 }
 
 func StartServer(c *gin.Context) {
-	currentStatus := ws.Manager.GetStatus()
-	if currentStatus == "online" || currentStatus == "starting" {
-		slog.Info("Received request to start server, but server is already online or starting")
-		c.JSON(http.StatusBadRequest, gin.H{
-			"message": "O servidor já está ligado ou iniciando",
-		})
+	if err := ws.Manager.CheckStart(); err != nil {
+		slog.Info("Received request to start server, but it can't be started", "reason", err)
+		serverOperationError(c, err)
 		return
 	}
 
+	if err := ws.Manager.StartServer(); err != nil {
+		serverOperationError(c, err)
+		return
+	}
 	slog.Info("Server is starting...")
-	ws.Manager.StartServer()
 
 	c.JSON(http.StatusOK, gin.H{"message": "O servidor está iniciando..."})
 }
 
 func StopServer(c *gin.Context) {
-	currentStatus := ws.Manager.GetStatus()
-	if currentStatus == "offline" || currentStatus == "stopping" {
+	if err := ws.Manager.CheckStop(); err != nil {
 		slog.Info("Received request to stop server, but server is already offline or stopping")
-		c.JSON(http.StatusBadRequest, gin.H{
-			"message": "O servidor já está desligado ou parando",
-		})
+		serverOperationError(c, err)
 		return
 	}
 
@@ -252,17 +370,25 @@ func StopServer(c *gin.Context) {
 }
 
 func RestartServer(c *gin.Context) {
-	currentStatus := ws.Manager.GetStatus()
-	if currentStatus != "online" && currentStatus != "offline" {
-		slog.Info("Received request to restart server, but server is currently changing state")
-		c.JSON(http.StatusBadRequest, gin.H{
-			"message": "O servidor está ocupado em outra operação",
-		})
+	if err := ws.Manager.CheckRestart(); err != nil {
+		slog.Info("Received request to restart server, but it can't be restarted", "reason", err)
+		serverOperationError(c, err)
 		return
 	}
 
-	ws.Manager.RestartServer()
+	if err := ws.Manager.RestartServer(); err != nil {
+		serverOperationError(c, err)
+		return
+	}
 
 	slog.Info("Server restarting...")
 	c.JSON(http.StatusOK, gin.H{"message": "O servidor está reiniciando..."})
 }
+
+func serverOperationError(c *gin.Context, err error) {
+	status := http.StatusBadRequest
+	if errors.Is(err, ws.ErrBackupRunning) {
+		status = http.StatusConflict
+	}
+	c.JSON(status, gin.H{"message": err.Error()})
+}
@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vnxcius/mcpanel-back/internal/mclog"
+)
+
+const (
+	defaultSearchLimit   = 200
+	maxSearchLimit       = 2000
+	defaultSearchTimeout = 5 * time.Second
+	maxSearchTimeout     = 30 * time.Second
+	maxSearchPattern     = 512
+
+	defaultLogLines = 500
+	maxLogLines     = 5000
+)
+
+/*
+Searches latest.log and its archives. Matches are streamed as
+newline-delimited JSON, one {"match": ...} object per line, followed by a
+{"result": ...} line saying whether the search was cut short.
+*/
+func SearchLogs(c *gin.Context) {
+	q, err := parseSearchQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	enc := json.NewEncoder(c.Writer)
+	res, err := mclog.Search(c.Request.Context(), logsPath, q, func(m mclog.Match) error {
+		if err := enc.Encode(gin.H{"match": m}); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	})
+	if err != nil {
+		_ = enc.Encode(gin.H{"error": err.Error()})
+		return
+	}
+
+	_ = enc.Encode(gin.H{"result": res})
+	c.Writer.Flush()
+}
+
+func parseSearchQuery(c *gin.Context) (mclog.SearchQuery, error) {
+	q := mclog.SearchQuery{
+		Text:       c.Query("q"),
+		Regex:      c.Query("regex") == "true",
+		IgnoreCase: c.DefaultQuery("ignoreCase", "true") == "true",
+		Thread:     c.Query("thread"),
+		Limit:      defaultSearchLimit,
+		Timeout:    defaultSearchTimeout,
+	}
+
+	if len(q.Text) > maxSearchPattern {
+		return q, errors.New("q is too long")
+	}
+	if err := q.Validate(); err != nil {
+		return q, err
+	}
+
+	for _, param := range c.QueryArray("level") {
+		for _, level := range strings.Split(param, ",") {
+			if level = strings.ToUpper(strings.TrimSpace(level)); level != "" {
+				q.Levels = append(q.Levels, level)
+			}
+		}
+	}
+
+	var err error
+	if q.From, err = parseTimeParam(c.Query("from"), false); err != nil {
+		return q, errors.New("invalid from date")
+	}
+	if q.To, err = parseTimeParam(c.Query("to"), true); err != nil {
+		return q, errors.New("invalid to date")
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		q.Limit, err = strconv.Atoi(limit)
+		if err != nil || q.Limit < 1 || q.Limit > maxSearchLimit {
+			return q, errors.New("limit must be between 1 and " + strconv.Itoa(maxSearchLimit))
+		}
+	}
+
+	if timeout := c.Query("timeout"); timeout != "" {
+		seconds, err := strconv.Atoi(timeout)
+		q.Timeout = time.Duration(seconds) * time.Second
+		if err != nil || q.Timeout < time.Second || q.Timeout > maxSearchTimeout {
+			return q, errors.New("timeout must be between 1 and " + strconv.Itoa(int(maxSearchTimeout.Seconds())) + " seconds")
+		}
+	}
+
+	return q, nil
+}
+
+func ListLogFiles(c *gin.Context) {
+	files, err := mclog.ListDir(filepath.Dir(logsPath))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"files": files})
+}
+
+/*
+Downloads a log file. Archives are sent as they are unless decompress=true,
+in which case they are decompressed while being sent.
+*/
+func DownloadLogFile(c *gin.Context) {
+	file, err := mclog.Lookup(filepath.Dir(logsPath), c.Param("name"))
+	if err != nil {
+		logFileError(c, err)
+		return
+	}
+
+	if !file.Compressed || c.Query("decompress") != "true" {
+		c.FileAttachment(file.Path(), file.Name)
+		return
+	}
+
+	r, err := file.Open()
+	if err != nil {
+		logFileError(c, err)
+		return
+	}
+	defer r.Close()
+
+	name := strings.TrimSuffix(file.Name, ".gz")
+	c.Header("Content-Disposition", `attachment; filename="`+name+`"`)
+	c.Header("Content-Type", "text/plain; charset=utf-8")
+	c.Status(http.StatusOK)
+	if _, err := io.Copy(c.Writer, r); err != nil {
+		slog.Warn("Failed to send decompressed log", "file", file.Name, "error", err)
+	}
+}
+
+/*
+Returns part of a log file: count lines starting at line from (1 based), or
+the last tail lines when tail is given.
+*/
+func GetLogFileLines(c *gin.Context) {
+	file, err := mclog.Lookup(filepath.Dir(logsPath), c.Param("name"))
+	if err != nil {
+		logFileError(c, err)
+		return
+	}
+
+	if tail := c.Query("tail"); tail != "" {
+		n, err := strconv.Atoi(tail)
+		if err != nil || n < 1 || n > maxLogLines {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "tail must be between 1 and " + strconv.Itoa(maxLogLines)})
+			return
+		}
+
+		lines, err := file.Tail(n)
+		if err != nil {
+			logFileError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"file": file, "lines": lines})
+		return
+	}
+
+	from, err := strconv.Atoi(c.DefaultQuery("from", "1"))
+	if err != nil || from < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from line"})
+		return
+	}
+	count, err := strconv.Atoi(c.DefaultQuery("count", strconv.Itoa(defaultLogLines)))
+	if err != nil || count < 1 || count > maxLogLines {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "count must be between 1 and " + strconv.Itoa(maxLogLines)})
+		return
+	}
+
+	lines, more, err := file.Lines(from, count)
+	if err != nil {
+		logFileError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"file": file, "from": from, "lines": lines, "hasMore": more})
+}
+
+func logFileError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, mclog.ErrInvalidName):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, mclog.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vnxcius/mcpanel-back/internal/api/middleware"
+	"github.com/vnxcius/mcpanel-back/internal/api/ws"
+	"github.com/vnxcius/mcpanel-back/internal/logging"
+	"github.com/vnxcius/mcpanel-back/internal/players"
+	"github.com/vnxcius/mcpanel-back/internal/rcon"
+	"github.com/vnxcius/mcpanel-back/internal/utils"
+)
+
+// Public, only tells how many players are online
+func GetPlayerCount(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"count": len(ws.Manager.OnlinePlayers())})
+}
+
+func GetPlayers(c *gin.Context) {
+	playtimes, err := players.Playtimes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	online := ws.Manager.OnlinePlayers()
+	for i := range online {
+		online[i].IP = ""
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"online":  online,
+		"count":   len(online),
+		"players": playtimes,
+	})
+}
+
+func GetPlayerSessions(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 500 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 500"})
+		return
+	}
+
+	sessions, err := players.Sessions(c.Query("name"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+func GetPlayerList(c *gin.Context) {
+	list := players.List(c.Param("list"))
+	entries, err := playerLists.Get(list)
+	if err != nil {
+		playerListError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"list": list, "entries": entries})
+}
+
+func AddToPlayerList(c *gin.Context) {
+	var change players.Change
+	if err := c.ShouldBindJSON(&change); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+
+	list := players.List(c.Param("list"))
+	result, err := playerLists.Add(list, change)
+	if err != nil {
+		playerListError(c, err)
+		return
+	}
+
+	notifyPlayerListChange(c, list, logging.PlayerListAdded, result, change.Reason)
+	c.JSON(http.StatusOK, result)
+}
+
+func RemoveFromPlayerList(c *gin.Context) {
+	list := players.List(c.Param("list"))
+	result, err := playerLists.Remove(list, c.Param("target"))
+	if err != nil {
+		playerListError(c, err)
+		return
+	}
+
+	notifyPlayerListChange(c, list, logging.PlayerListRemoved, result, "")
+	c.JSON(http.StatusOK, result)
+}
+
+func GetPlayerListChangelog(c *gin.Context) {
+	changes, err := utils.GetPlayerListChangelog()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"changes": changes})
+}
+
+func notifyPlayerListChange(
+	c *gin.Context,
+	list players.List,
+	action logging.PlayerListAction,
+	result players.Result,
+	reason string,
+) {
+	change := logging.LogPlayerListChange(logging.PlayerListChangeEntry{
+		List:    string(list),
+		Action:  action,
+		Player:  result.Name,
+		UUID:    result.UUID,
+		Address: result.IP,
+		Reason:  reason,
+		Via:     result.Via,
+		Actor:   middleware.GetActor(c),
+		IP:      c.ClientIP(),
+	})
+
+	payload, err := json.Marshal(change)
+	if err != nil {
+		return
+	}
+	ws.Manager.Publish(ws.TopicPlayers, ws.EventPlayerListChange, payload)
+}
+
+func playerListError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, players.ErrInvalidList),
+		errors.Is(err, players.ErrInvalidPlayer),
+		errors.Is(err, players.ErrInvalidIP):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, players.ErrNotListed), errors.Is(err, players.ErrUnknownPlayer):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, players.ErrServerBusy):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, rcon.ErrNotConfigured), errors.Is(err, rcon.ErrAuthFailed),
+		errors.Is(err, players.ErrLookupFailed):
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vnxcius/mcpanel-back/internal/api/middleware"
+	"github.com/vnxcius/mcpanel-back/internal/api/ws"
+	"github.com/vnxcius/mcpanel-back/internal/configs"
+	"github.com/vnxcius/mcpanel-back/internal/logging"
+	"github.com/vnxcius/mcpanel-back/internal/properties"
+	"github.com/vnxcius/mcpanel-back/internal/utils"
+)
+
+const serverPropertiesFile = "server.properties"
+
+// serialises read-modify-write cycles on server.properties
+var propertiesMu sync.Mutex
+
+type updatePropertiesRequest struct {
+	Hash       string                     `json:"hash" binding:"required"`
+	Properties map[string]json.RawMessage `json:"properties" binding:"required"`
+}
+
+func GetServerProperties(c *gin.Context) {
+	data, props, err := readServerProperties()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	typed, others := props.Server()
+	c.JSON(http.StatusOK, gin.H{
+		"properties": typed,
+		"others":     others,
+		"hash":       configs.Hash(data),
+	})
+}
+
+func UpdateServerProperties(c *gin.Context) {
+	var req updatePropertiesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+
+	propertiesMu.Lock()
+	defer propertiesMu.Unlock()
+
+	data, props, err := readServerProperties()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	oldHash := configs.Hash(data)
+	if oldHash != req.Hash {
+		c.JSON(http.StatusConflict, gin.H{"error": configs.ErrHashMismatch.Error()})
+		return
+	}
+
+	changed, err := props.Update(req.Properties)
+	if err != nil {
+		var invalid *properties.InvalidValueError
+		switch {
+		case errors.Is(err, properties.ErrUnknownKey), errors.As(err, &invalid):
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	newData := props.Bytes()
+	if len(changed) > 0 {
+		path := filepath.Join(serverDir, serverPropertiesFile)
+		if err := utils.WriteFileAtomic(path, newData); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		change := logging.LogConfigChange(logging.ConfigChangeEntry{
+			Type:    logging.ConfigEdited,
+			Path:    serverPropertiesFile,
+			OldHash: oldHash,
+			NewHash: configs.Hash(newData),
+			Actor:   middleware.GetActor(c),
+			IP:      c.ClientIP(),
+		})
+		if payload, err := json.Marshal(change); err == nil {
+			ws.Manager.Publish(ws.TopicConfig, ws.EventConfigChanged, payload)
+		}
+	}
+
+	// the server only reads server.properties on startup
+	restartRequired := []string{}
+	if ws.Manager.GetStatus() != "offline" {
+		restartRequired = changed
+	}
+
+	typed, others := props.Server()
+	c.JSON(http.StatusOK, gin.H{
+		"properties":      typed,
+		"others":          others,
+		"hash":            configs.Hash(newData),
+		"changed":         changed,
+		"restartRequired": restartRequired,
+	})
+}
+
+func readServerProperties() ([]byte, *properties.File, error) {
+	data, err := os.ReadFile(filepath.Join(serverDir, serverPropertiesFile))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	props, err := properties.Parse(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return data, props, nil
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vnxcius/mcpanel-back/internal/logging"
+)
+
+const (
+	defaultSystemLogLimit = 200
+	maxSystemLogLimit     = 2000
+)
+
+/*
+Reads the panel's own log, newest records first, going back through the
+rotated files as needed. Accepts q (text), level (minimum level), from, to
+and limit.
+*/
+func GetSystemLogs(c *gin.Context) {
+	q, err := parseSystemLogQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	records, err := logging.SearchSystemLog(q)
+	if err != nil {
+		slog.Error("Failed to read system log", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read system log"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"records": records})
+}
+
+func ListSystemLogFiles(c *gin.Context) {
+	files, err := logging.SystemLogFiles()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"files": files})
+}
+
+func parseSystemLogQuery(c *gin.Context) (logging.SystemLogQuery, error) {
+	q := logging.SystemLogQuery{
+		Text:  c.Query("q"),
+		Level: slog.LevelDebug,
+		Limit: defaultSystemLogLimit,
+	}
+
+	if len(q.Text) > maxSearchPattern {
+		return q, errors.New("q is too long")
+	}
+
+	var err error
+	if level := c.Query("level"); level != "" {
+		if q.Level, err = logging.ParseLevel(level); err != nil {
+			return q, err
+		}
+	}
+	if q.From, err = parseTimeParam(c.Query("from"), false); err != nil {
+		return q, errors.New("invalid from date")
+	}
+	if q.To, err = parseTimeParam(c.Query("to"), true); err != nil {
+		return q, errors.New("invalid to date")
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		q.Limit, err = strconv.Atoi(limit)
+		if err != nil || q.Limit < 1 || q.Limit > maxSystemLogLimit {
+			return q, errors.New("limit must be between 1 and " + strconv.Itoa(maxSystemLogLimit))
+		}
+	}
+
+	return q, nil
+}
+
+func GetLogLevel(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"level": logging.Level()})
+}
+
+/*
+Changes the minimum level of the panel's log until the next restart, where
+LOG_LEVEL applies again.
+*/
+func SetLogLevel(c *gin.Context) {
+	var body struct {
+		Level string `json:"level" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "level is required"})
+		return
+	}
+
+	previous := logging.Level()
+	if err := logging.SetLevel(body.Level); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "level must be debug, info, warn or error"})
+		return
+	}
+
+	slog.Warn("Log level changed", "from", previous, "to", logging.Level(), "ip", c.ClientIP())
+	c.JSON(http.StatusOK, gin.H{"level": logging.Level()})
+}
@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"database/sql"
+	"errors"
 	"log/slog"
 	"net/http"
 	"os"
@@ -10,6 +11,12 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/vnxcius/mcpanel-back/internal/db"
+	"github.com/vnxcius/mcpanel-back/internal/logging"
+)
+
+const (
+	actorKey   = "actor"
+	sessionKey = "session"
 )
 
 type Session struct {
@@ -41,6 +48,7 @@ func TokenAuth() gin.HandlerFunc {
 
 		if token == os.Getenv("DISCORD_BOT_TOKEN") {
 			slog.Info("Discord bot request received, skipping session token validation")
+			c.Set(actorKey, logging.Actor{Kind: logging.ActorBot, Name: "discord-bot"})
 			c.Next()
 			return
 		}
@@ -65,6 +73,64 @@ func TokenAuth() gin.HandlerFunc {
 		}
 
 		slog.Info("Session token successfully validated")
+		c.Set(actorKey, sessionActor(token))
+		c.Set(sessionKey, token)
 		c.Next()
 	}
 }
+
+/*
+Returns who made the request. Requests that did not pass through TokenAuth
+are reported as external.
+*/
+func GetActor(c *gin.Context) *logging.Actor {
+	if v, ok := c.Get(actorKey); ok {
+		if actor, ok := v.(logging.Actor); ok {
+			return &actor
+		}
+	}
+	return &logging.Actor{Kind: logging.ActorExternal, Name: c.ClientIP()}
+}
+
+/*
+Returns the session token of the request, empty for the bot and requests
+that did not pass through TokenAuth.
+*/
+func GetSession(c *gin.Context) string {
+	return c.GetString(sessionKey)
+}
+
+// Tells whether a session token is still in the "Session" table, like TokenAuth
+func SessionActive(token string) (bool, error) {
+	var retrievedID string
+	err := db.DBConn.QueryRow(`SELECT id FROM "Session" WHERE id = $1`, token).Scan(&retrievedID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+/*
+Names the actor of a validated session after the "userId" of its row. The
+table belongs to the frontend, so this is best effort: when the user can't
+be read the session id stands in, attribution never fails a request.
+*/
+func sessionActor(token string) logging.Actor {
+	var userID sql.NullString
+	err := db.DBConn.QueryRow(`SELECT "userId" FROM "Session" WHERE id = $1`, token).Scan(&userID)
+	if err != nil {
+		slog.Debug("Could not read the user of a session", "error", err)
+	}
+	if err == nil && userID.String != "" {
+		return logging.Actor{Kind: logging.ActorSession, Name: userID.String}
+	}
+
+	if token == "" {
+		return logging.Actor{Kind: logging.ActorSession, Name: "unknown"}
+	}
+	// never log the full token
+	if len(token) > 8 {
+		token = token[:8]
+	}
+	return logging.Actor{Kind: logging.ActorSession, Name: "session:" + token}
+}
@@ -36,8 +36,8 @@ func NewRouter() {
 	slog.Info("Allowing origins", "origins", allowedOrigins)
 	r.Use(cors.New(cors.Config{
 		AllowOrigins: allowedOrigins,
-		AllowMethods: []string{"GET", "POST", "OPTIONS", "DELETE"},
-		AllowHeaders: []string{"Content-Type", "Authorization"},
+		AllowMethods: []string{"GET", "POST", "PUT", "OPTIONS", "DELETE"},
+		AllowHeaders: []string{"Content-Type", "Authorization", "Last-Event-ID"},
 		ExposeHeaders: []string{
 			"Content-Length",
 			"X-RateLimit-Limit",
@@ -67,8 +67,12 @@ func NewRouter() {
 			ctx.HTML(http.StatusOK, "privacy-policy", nil)
 		})
 		v2.GET("/ws", handlers.ServeWebSocket)
+		v2.GET("/events", handlers.StreamEvents)
 		v2.GET("/server-status", handlers.GetServerStatus)
 		v2.GET("/modlist", handlers.GetModlist)
+		v2.GET("/modlist/changelog", handlers.GetModsChangelog)
+		v2.GET("/modlist/changelog/export", handlers.ExportModsChangelog)
+		v2.GET("/players", handlers.GetPlayerCount)
 	}
 
 	{
@@ -76,6 +80,9 @@ func NewRouter() {
 		protected.Use(middleware.RateLimit())
 		protected.Use(middleware.TokenAuth())
 
+		protected.POST("/ws/ticket", handlers.IssueWebSocketTicket)
+		protected.GET("/ws/topics", handlers.GetWebSocketTopics)
+
 		protected.POST("/server/start", handlers.StartServer)
 		protected.POST("/server/stop", handlers.StopServer)
 		protected.POST("/server/restart", handlers.RestartServer)
@@ -84,6 +91,47 @@ func NewRouter() {
 		protected.GET("/mod/download/:name", handlers.DownloadMod)
 		protected.POST("/mod/update/:name", handlers.UpdateMod)
 		protected.DELETE("/mod/delete/:name", handlers.DeleteMod)
+
+		protected.GET("/server/properties", handlers.GetServerProperties)
+		protected.PUT("/server/properties", handlers.UpdateServerProperties)
+
+		protected.GET("/players", handlers.GetPlayers)
+		protected.GET("/players/sessions", handlers.GetPlayerSessions)
+		protected.GET("/players/lists/:list", handlers.GetPlayerList)
+		protected.POST("/players/lists/:list", handlers.AddToPlayerList)
+		protected.DELETE("/players/lists/:list/:target", handlers.RemoveFromPlayerList)
+		protected.GET("/players/audit", handlers.GetPlayerListChangelog)
+
+		protected.GET("/backups", handlers.ListBackups)
+		protected.POST("/backups", handlers.CreateBackup)
+		protected.GET("/backups/:name/download", handlers.DownloadBackup)
+		protected.DELETE("/backups/:name", handlers.DeleteBackup)
+		protected.POST("/backups/:name/restore", handlers.RestoreBackup)
+
+		protected.GET("/configs", handlers.ListConfigs)
+		protected.GET("/configs/file", handlers.GetConfigFile)
+		protected.PUT("/configs/file", handlers.SaveConfigFile)
+		protected.POST("/configs/undo", handlers.UndoConfigFile)
+		protected.GET("/configs/changelog", handlers.GetConfigsChangelog)
+
+		protected.GET("/logs/search", handlers.SearchLogs)
+		protected.GET("/logs/files", handlers.ListLogFiles)
+		protected.GET("/logs/files/:name/download", handlers.DownloadLogFile)
+		protected.GET("/logs/files/:name/lines", handlers.GetLogFileLines)
+
+		protected.GET("/crashes", handlers.ListCrashReports)
+		protected.GET("/crashes/:id", handlers.GetCrashReport)
+
+		protected.GET("/alerts/rules", handlers.ListAlertRules)
+		protected.POST("/alerts/rules", handlers.CreateAlertRule)
+		protected.PUT("/alerts/rules/:id", handlers.UpdateAlertRule)
+		protected.DELETE("/alerts/rules/:id", handlers.DeleteAlertRule)
+		protected.GET("/alerts/history", handlers.GetAlertHistory)
+
+		protected.GET("/system/logs", handlers.GetSystemLogs)
+		protected.GET("/system/logs/files", handlers.ListSystemLogFiles)
+		protected.GET("/system/log-level", handlers.GetLogLevel)
+		protected.PUT("/system/log-level", handlers.SetLogLevel)
 	}
 
 	r.NoRoute(func(c *gin.Context) {
@@ -0,0 +1,85 @@
+package ws
+
+import (
+	"encoding/json"
+	"log/slog"
+
+	"github.com/vnxcius/mcpanel-back/internal/logging"
+)
+
+const (
+	changelogPageSize    = 50
+	maxChangelogPageSize = 200
+)
+
+type ChangelogPageRequest struct {
+	Cursor int64 `json:"cursor"`
+	Limit  int   `json:"limit"`
+}
+
+type ChangelogAppendEvent struct {
+	Changes []logging.ModChangeEntry `json:"changes"`
+}
+
+/*
+Answers a modlist_changelog_page request for older entries, starting after
+the given cursor. The reply uses the same event type so clients can tell it
+apart from the first page sent on connect, which replaces their list.
+*/
+func changelogPageHandler(event Event, c *Client) (any, error) {
+	var req ChangelogPageRequest
+	if len(event.Payload) > 0 {
+		if err := json.Unmarshal(event.Payload, &req); err != nil {
+			return nil, err
+		}
+	}
+
+	if req.Cursor < 0 {
+		return nil, invalidPayload("invalid changelog cursor")
+	}
+	if req.Limit < 1 || req.Limit > maxChangelogPageSize {
+		req.Limit = changelogPageSize
+	}
+
+	c.sendChangelogPage(EventChangelogPage, req.Cursor, req.Limit)
+	return nil, nil
+}
+
+func (c *Client) sendChangelogPage(eventType string, cursor int64, limit int) {
+	page, err := logging.QueryModChanges(logging.ModChangeQuery{Cursor: cursor, Limit: limit})
+	if err != nil {
+		slog.Error("Failed to read mod changelog", "error", err)
+		return
+	}
+
+	for i := range page.Changes {
+		page.Changes[i].IP = ""
+		if c.Tier() < TierAuthenticated {
+			page.Changes[i] = page.Changes[i].Redacted()
+		}
+	}
+
+	// the first page keeps the plain array modlist_changelog always had,
+	// the id of its last entry is the cursor for the next one
+	var body any = page
+	if eventType == EventModlistChangelog {
+		body = page.Changes
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		slog.Error("Error marshalling changelog page", "error", err)
+		return
+	}
+	c.send(Event{Type: eventType, Payload: payload})
+}
+
+// Sends only the new entry to clients instead of the whole changelog
+func (m *WSManager) appendChangelog(change logging.ModChangeEntry) {
+	payload, err := json.Marshal(ChangelogAppendEvent{Changes: []logging.ModChangeEntry{change}})
+	if err != nil {
+		slog.Error("Error marshalling changelog entry", "error", err)
+		return
+	}
+	redacted, _ := json.Marshal(ChangelogAppendEvent{Changes: []logging.ModChangeEntry{change.Redacted()}})
+	m.publish(TopicChangelog, Event{Type: EventChangelogAppend, Payload: payload}, redacted)
+}
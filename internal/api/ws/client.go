@@ -1,36 +1,84 @@
 package ws
 
 import (
-	"encoding/json"
+	"errors"
 	"log/slog"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/vnxcius/mcpanel-back/internal/logging"
 )
 
 type Client struct {
 	connection *websocket.Conn
 	manager    *WSManager
 	ip         string
+	// set for connections opened with a ticket
+	actor *logging.Actor
+	// token of the session the ticket was issued to, empty for the bot
+	session string
+	// protocol version agreed on when connecting
+	protocol int
+
+	// encoding picked through the subprotocol
+	codec *codec
 
 	// Buffered channel of outbound messages
 	egress chan Event
+	// closed once the client is removed
+	done chan struct{}
+
+	console console
+	subs    subscriptions
 }
 
 type ClientList map[*Client]bool
 
+/*
+Tier is what a client may see. Public clients get the server status, the
+mod list and the player count; authenticated ones everything else too.
+*/
+type Tier int
+
+const (
+	TierPublic Tier = iota
+	TierAuthenticated
+)
+
+const (
+	// frames smaller than this are sent uncompressed
+	minCompressSize = 512
+	// largest request a client may send, filters and commands are short
+	maxMessageSize = 4 << 10
+)
+
 var (
 	pongWait     = 10 * time.Second
 	pingInterval = (pongWait * 9) / 10 // 90% of pongWait
 )
 
 func NewClient(conn *websocket.Conn, m *WSManager, ip string) *Client {
+	cd := jsonCodec
+	if conn != nil {
+		cd = codecFor(conn.Subprotocol())
+	}
+
 	return &Client{
 		connection: conn,
 		manager:    m,
+		codec:      cd,
 		egress:     make(chan Event, 500),
+		done:       make(chan struct{}),
 		ip:         ip,
+		subs:       subscriptions{topics: map[Topic]bool{}},
+	}
+}
+
+func (c *Client) Tier() Tier {
+	if c.actor != nil {
+		return TierAuthenticated
 	}
+	return TierPublic
 }
 
 func (c *Client) send(evt Event) {
@@ -52,7 +100,7 @@ func (c *Client) ReadMessages() {
 		return
 	}
 
-	c.connection.SetReadLimit(512)
+	c.connection.SetReadLimit(maxMessageSize)
 	c.connection.SetPongHandler(c.pongHandler)
 
 	for {
@@ -64,18 +112,25 @@ func (c *Client) ReadMessages() {
 			break
 		}
 
-		var request Event
+		slog.Debug("Received message", "type", messageType, "payload", string(payload))
 
-		if err := json.Unmarshal(payload, &request); err != nil {
-			slog.Error("Error unmarshalling message", "error", err)
-			break
+		// a bad message gets an error frame, the connection stays open
+		request, err := c.codec.decode(messageType, payload)
+		if err != nil || request.Type == "" {
+			slog.Warn("Invalid websocket message", "ip", c.ip, "error", err)
+			c.sendError(request, &Error{Code: CodeInvalidMessage, Err: errors.New("message is not a valid event")})
+			continue
 		}
 
-		if err := c.manager.routeEvent(request, c); err != nil {
-			slog.Error("Error handleling message", "error", err)
+		result, err := c.manager.routeEvent(request, c)
+		if err != nil {
+			slog.Warn("Error handling message", "type", request.Type, "error", err)
+			c.sendError(request, err)
+			continue
+		}
+		if result != nil || request.ID != "" {
+			c.ack(request, result)
 		}
-
-		slog.Info("Received message", "type", messageType, "payload", string(payload))
 	}
 }
 
@@ -97,13 +152,15 @@ func (c *Client) WriteMessages() {
 				return
 			}
 
-			data, err := json.Marshal(message)
+			data, err := c.codec.encode(message)
 			if err != nil {
 				slog.Error("Error marshalling message", "error", err)
 				return
 			}
 
-			if err := c.connection.WriteMessage(websocket.TextMessage, data); err != nil {
+			// small frames aren't worth deflating
+			c.connection.EnableWriteCompression(len(data) >= minCompressSize)
+			if err := c.connection.WriteMessage(c.codec.messageType, data); err != nil {
 				slog.Error("Error sending message", "error", err)
 				return
 			}
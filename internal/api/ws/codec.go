@@ -0,0 +1,158 @@
+package ws
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sync"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+/*
+Subprotocols clients may ask for in Sec-WebSocket-Protocol. The binary ones
+send the same events as MessagePack or CBOR frames; without one, or with
+mcpanel.json, events are JSON text frames.
+*/
+const (
+	SubprotocolJSON    = "mcpanel.json"
+	SubprotocolMsgpack = "mcpanel.msgpack"
+	SubprotocolCBOR    = "mcpanel.cbor"
+)
+
+var Subprotocols = []string{SubprotocolJSON, SubprotocolMsgpack, SubprotocolCBOR}
+
+// Encodes events for a client, as picked by its subprotocol
+type codec struct {
+	messageType int
+	marshal     func(any) ([]byte, error)
+	unmarshal   func([]byte, any) error
+}
+
+// Event as sent in binary frames, with the payload as a value instead of JSON
+type binaryEvent struct {
+	ID      string `json:"id,omitempty" msgpack:"id,omitempty"`
+	Seq     uint64 `json:"seq,omitempty" msgpack:"seq,omitempty"`
+	Type    string `json:"type" msgpack:"type"`
+	Payload any    `json:"payload" msgpack:"payload"`
+}
+
+var (
+	jsonCodec = &codec{messageType: websocket.TextMessage, marshal: json.Marshal, unmarshal: json.Unmarshal}
+
+	// maps decode with string keys so payloads convert back to JSON
+	cborDecoder, _ = cbor.DecOptions{DefaultMapType: reflect.TypeOf(map[string]any(nil))}.DecMode()
+
+	codecs = map[string]*codec{
+		SubprotocolMsgpack: {messageType: websocket.BinaryMessage, marshal: msgpack.Marshal, unmarshal: msgpack.Unmarshal},
+		SubprotocolCBOR:    {messageType: websocket.BinaryMessage, marshal: cbor.Marshal, unmarshal: cborDecoder.Unmarshal},
+	}
+)
+
+func codecFor(subprotocol string) *codec {
+	if cd, ok := codecs[subprotocol]; ok {
+		return cd
+	}
+	return jsonCodec
+}
+
+/*
+Frames of a published event, encoded once per codec and shared by every
+client that gets the event, replays included.
+*/
+type frames struct {
+	sync.Mutex
+	data map[*codec][]byte
+}
+
+func newFrames() *frames {
+	return &frames{data: map[*codec][]byte{}}
+}
+
+func (cd *codec) encode(evt Event) ([]byte, error) {
+	if evt.frames == nil {
+		return cd.marshalEvent(evt)
+	}
+
+	evt.frames.Lock()
+	defer evt.frames.Unlock()
+	if data, ok := evt.frames.data[cd]; ok {
+		return data, nil
+	}
+	data, err := cd.marshalEvent(evt)
+	if err != nil {
+		return nil, err
+	}
+	evt.frames.data[cd] = data
+	return data, nil
+}
+
+func (cd *codec) marshalEvent(evt Event) ([]byte, error) {
+	if cd == jsonCodec {
+		return json.Marshal(evt)
+	}
+
+	var payload any
+	if len(evt.Payload) > 0 {
+		dec := json.NewDecoder(bytes.NewReader(evt.Payload))
+		dec.UseNumber()
+		if err := dec.Decode(&payload); err != nil {
+			return nil, err
+		}
+	}
+	return cd.marshal(binaryEvent{
+		ID:      evt.ID,
+		Seq:     evt.Seq,
+		Type:    evt.Type,
+		Payload: numbers(payload),
+	})
+}
+
+/*
+Reads a client request. Binary frames are decoded with the client's codec,
+text frames are always JSON.
+*/
+func (cd *codec) decode(messageType int, data []byte) (Event, error) {
+	var evt Event
+	if messageType == websocket.TextMessage || cd == jsonCodec {
+		err := json.Unmarshal(data, &evt)
+		return evt, err
+	}
+
+	var req binaryEvent
+	if err := cd.unmarshal(data, &req); err != nil {
+		return evt, err
+	}
+	evt = Event{ID: req.ID, Type: req.Type}
+	if req.Payload != nil {
+		payload, err := json.Marshal(req.Payload)
+		if err != nil {
+			return evt, err
+		}
+		evt.Payload = payload
+	}
+	return evt, nil
+}
+
+// Turns the JSON numbers of a decoded payload into integers where they fit
+func numbers(v any) any {
+	switch v := v.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]any:
+		for k, e := range v {
+			v[k] = numbers(e)
+		}
+	case []any:
+		for i, e := range v {
+			v[i] = numbers(e)
+		}
+	}
+	return v
+}
@@ -0,0 +1,137 @@
+package ws
+
+import (
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+	"github.com/vnxcius/mcpanel-back/internal/logging"
+)
+
+// A codec counting how many times it marshals an event
+func countingCodec(marshal func(any) ([]byte, error), unmarshal func([]byte, any) error) (*codec, *atomic.Int64) {
+	calls := &atomic.Int64{}
+	return &codec{
+		messageType: websocket.BinaryMessage,
+		marshal: func(v any) ([]byte, error) {
+			calls.Add(1)
+			return marshal(v)
+		},
+		unmarshal: unmarshal,
+	}, calls
+}
+
+func TestPublishEncodesOncePerCodec(t *testing.T) {
+	m := newTestManager()
+	msgpackCodec, msgpackCalls := countingCodec(msgpack.Marshal, msgpack.Unmarshal)
+	cborCodec, cborCalls := countingCodec(cbor.Marshal, cborDecoder.Unmarshal)
+	actor := &logging.Actor{Kind: logging.ActorSession, Name: "admin"}
+
+	// three clients per codec, public and authenticated
+	var clients []*Client
+	for _, cd := range []*codec{jsonCodec, msgpackCodec, cborCodec} {
+		for i := range 3 {
+			c := NewClient(nil, m, "127.0.0.1")
+			c.codec = cd
+			if i == 0 {
+				c.actor = actor
+			}
+			m.register(c, ClientOptions{Actor: c.actor, Topics: []Topic{TopicChangelog}, Since: m.replay.last()})
+			received(c)
+			clients = append(clients, c)
+		}
+	}
+	start := m.replay.last()
+
+	m.appendChangelog(logging.ModChangeEntry{Type: logging.ModAdded, Name: "ae2.jar", Actor: actor})
+
+	// the first frame each codec encoded, per tier
+	encoded := map[*codec]map[Tier][]byte{}
+	send := func(c *Client, evt Event) {
+		t.Helper()
+		data, err := c.codec.encode(evt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if encoded[c.codec] == nil {
+			encoded[c.codec] = map[Tier][]byte{}
+		}
+		first, ok := encoded[c.codec][c.Tier()]
+		if !ok {
+			encoded[c.codec][c.Tier()] = data
+			return
+		}
+		if &first[0] != &data[0] {
+			t.Fatalf("%s client got a frame of its own", evt.Type)
+		}
+	}
+
+	for _, c := range clients {
+		events := received(c)
+		if len(events) != 1 {
+			t.Fatalf("got %d events, want the changelog append", len(events))
+		}
+		send(c, events[0])
+	}
+
+	// replays share the frames of the published event too
+	for _, c := range clients {
+		missed, ok := c.missedEvents(start)
+		if !ok || len(missed) != 1 {
+			t.Fatalf("got %d missed events, %v", len(missed), ok)
+		}
+		send(c, missed[0])
+	}
+
+	// once for the public payload and once for the full one
+	if n := msgpackCalls.Load(); n != 2 {
+		t.Errorf("msgpack encoded %d times, want 2", n)
+	}
+	if n := cborCalls.Load(); n != 2 {
+		t.Errorf("cbor encoded %d times, want 2", n)
+	}
+
+	changes := func(frame []byte) []logging.ModChangeEntry {
+		t.Helper()
+		var evt Event
+		var appended ChangelogAppendEvent
+		if err := json.Unmarshal(frame, &evt); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(evt.Payload, &appended); err != nil || len(appended.Changes) != 1 {
+			t.Fatalf("got payload %s: %v", evt.Payload, err)
+		}
+		return appended.Changes
+	}
+	if change := changes(encoded[jsonCodec][TierPublic])[0]; change.Actor != nil {
+		t.Fatalf("public frame carries the actor: %+v", change)
+	}
+	if change := changes(encoded[jsonCodec][TierAuthenticated])[0]; change.Actor == nil {
+		t.Fatalf("authenticated frame lost the actor: %+v", change)
+	}
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	evt := Event{Seq: 7, Type: EventPlayerCount, Payload: json.RawMessage(`{"online":3,"max":20,"ratio":0.15}`)}
+
+	for name, cd := range map[string]*codec{"json": jsonCodec, "msgpack": codecs[SubprotocolMsgpack], "cbor": codecs[SubprotocolCBOR]} {
+		t.Run(name, func(t *testing.T) {
+			data, err := cd.encode(evt)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got binaryEvent
+			if err := cd.unmarshal(data, &got); err != nil {
+				t.Fatal(err)
+			}
+			payload, _ := json.Marshal(got.Payload)
+			if got.Seq != 7 || got.Type != EventPlayerCount || string(payload) != `{"max":20,"online":3,"ratio":0.15}` {
+				t.Fatalf("got %+v with payload %s", got, payload)
+			}
+		})
+	}
+}
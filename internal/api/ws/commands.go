@@ -0,0 +1,224 @@
+package ws
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/vnxcius/mcpanel-back/internal/api/middleware"
+	"github.com/vnxcius/mcpanel-back/internal/logging"
+	"github.com/vnxcius/mcpanel-back/internal/otp"
+	"github.com/vnxcius/mcpanel-back/internal/rcon"
+	"github.com/vnxcius/mcpanel-back/internal/utils"
+)
+
+const maxCommandLength = 256
+
+var (
+	errNotAuthenticated = errors.New("authentication required")
+	errSessionExpired   = errors.New("session expired")
+)
+
+/*
+AckEvent answers a request that succeeded. ID and Type are those of the
+request; Result holds what the request returned, Message replaces it when
+that is only a text. Failed requests get an ErrorEvent instead.
+*/
+type AckEvent struct {
+	ID      string `json:"id,omitempty"`
+	Type    string `json:"type"`
+	OK      bool   `json:"ok"`
+	Message string `json:"message,omitempty"`
+	Result  any    `json:"result,omitempty"`
+}
+
+/*
+SessionEvent is the first event of a connection. Seq is the number of the
+latest published event when the client connected; Resumed tells whether
+the events it missed were replayed instead of sending snapshots. Protocol
+is the version agreed on.
+*/
+type SessionEvent struct {
+	Authenticated bool           `json:"authenticated"`
+	Actor         *logging.Actor `json:"actor,omitempty"`
+	Seq           uint64         `json:"seq"`
+	Resumed       bool           `json:"resumed"`
+	Protocol      int            `json:"protocol"`
+}
+
+type ConsoleCommandRequest struct {
+	Command string `json:"command"`
+}
+
+type ModToggleRequest struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	Comment string `json:"comment"`
+}
+
+/*
+Issues a one-time ticket for opening a websocket as actor. The ticket is
+passed as ?otp= on the upgrade request. session is the token the
+connection stays tied to, empty for the bot.
+*/
+func (m *WSManager) IssueTicket(actor logging.Actor, session string) otp.OTP {
+	return m.otps.Add(actor, session)
+}
+
+// Consumes a ticket, returning it with the actor it was issued to
+func (m *WSManager) RedeemTicket(key string) (otp.OTP, bool) {
+	return m.otps.VerifyOTP(key)
+}
+
+/*
+Wraps handlers public clients may not use. The session the client
+connected with is checked again, a client whose session is gone is
+disconnected.
+*/
+func authenticated(handler EventHandler) EventHandler {
+	return func(event Event, c *Client) (any, error) {
+		if c.Tier() < TierAuthenticated {
+			return nil, errNotAuthenticated
+		}
+		if c.session != "" {
+			active, err := middleware.SessionActive(c.session)
+			if err != nil {
+				slog.Error("Failed to check websocket session", "error", err)
+				return nil, err
+			}
+			if !active {
+				go c.manager.expireSession(c)
+				return nil, errSessionExpired
+			}
+		}
+		return handler(event, c)
+	}
+}
+
+func (c *Client) ack(event Event, result any) {
+	ack := AckEvent{
+		ID:     event.ID,
+		Type:   event.Type,
+		OK:     true,
+		Result: result,
+	}
+	if message, ok := result.(string); ok {
+		ack.Message, ack.Result = message, nil
+	}
+
+	payload, _ := json.Marshal(ack)
+	c.send(Event{ID: event.ID, Type: EventAck, Payload: payload})
+}
+
+func serverStartHandler(event Event, c *Client) (any, error) {
+	if err := c.manager.CheckStart(); err != nil {
+		return nil, err
+	}
+
+	slog.Info("Server is starting...", "actor", c.actor.Name)
+	if err := c.manager.StartServer(); err != nil {
+		return nil, err
+	}
+	return "O servidor está iniciando...", nil
+}
+
+func serverStopHandler(event Event, c *Client) (any, error) {
+	if err := c.manager.CheckStop(); err != nil {
+		return nil, err
+	}
+
+	slog.Info("Server stopping...", "actor", c.actor.Name)
+	c.manager.StopServer()
+	return "O servidor está parando...", nil
+}
+
+func serverRestartHandler(event Event, c *Client) (any, error) {
+	if err := c.manager.CheckRestart(); err != nil {
+		return nil, err
+	}
+
+	slog.Info("Server restarting...", "actor", c.actor.Name)
+	if err := c.manager.RestartServer(); err != nil {
+		return nil, err
+	}
+	return "O servidor está reiniciando...", nil
+}
+
+/*
+Runs a console command through RCON. The reply of the server is the ack
+result; the command's log output arrives with the console stream.
+*/
+func consoleCommandHandler(event Event, c *Client) (any, error) {
+	var req ConsoleCommandRequest
+	if err := json.Unmarshal(event.Payload, &req); err != nil {
+		return nil, err
+	}
+
+	command := strings.TrimPrefix(strings.TrimSpace(req.Command), "/")
+	if command == "" || len(command) > maxCommandLength || strings.ContainsAny(command, "\r\n") {
+		return nil, invalidPayload("invalid console command")
+	}
+	if c.manager.GetStatus() != "online" {
+		return nil, &Error{Code: CodeConflict, Err: errors.New("O servidor não está ligado")}
+	}
+
+	slog.Info("Console command", "actor", c.actor.Name, "ip", c.ip, "command", command)
+	reply, err := rcon.Command(command)
+	if err != nil {
+		slog.Error("Console command failed", "command", command, "error", err)
+		return nil, err
+	}
+
+	return map[string]string{"reply": reply}, nil
+}
+
+/*
+Enables or disables a mod. Takes effect on the next server start. For the
+changelog a disabled mod is gone from the server, so disabling is logged
+as a deletion of the jar and enabling as its addition.
+*/
+func modToggleHandler(event Event, c *Client) (any, error) {
+	var req ModToggleRequest
+	if err := json.Unmarshal(event.Payload, &req); err != nil {
+		return nil, err
+	}
+
+	modsDir := os.Getenv("MODS_PATH")
+	old, name, err := utils.SetModEnabled(modsDir, req.Name, req.Enabled)
+	if err != nil {
+		return nil, err
+	}
+	if old == "" {
+		return map[string]any{"name": name, "enabled": req.Enabled}, nil
+	}
+
+	slog.Info("Mod toggled", "actor", c.actor.Name, "ip", c.ip, "name", name, "enabled", req.Enabled)
+
+	file, err := utils.ReadModFile(filepath.Join(modsDir, name))
+	if err != nil {
+		slog.Warn("Failed to read mod file details", "name", name, "error", err)
+		file = logging.ModFile{}
+	}
+
+	eventType, entry := toggleChange(old, name, req.Enabled, file)
+	entry.Actor, entry.IP, entry.Comment = c.actor, c.ip, req.Comment
+	c.manager.UpdateModlist(eventType, logging.LogModChange(entry))
+
+	return map[string]any{"name": name, "enabled": req.Enabled}, nil
+}
+
+/*
+Builds the changelog entry of a mod renamed from old to name by a toggle,
+named after the enabled jar either way, and the event announcing it.
+*/
+func toggleChange(old, name string, enabled bool, file logging.ModFile) (string, logging.ModChangeEntry) {
+	if enabled {
+		file.Name = name
+		return EventModAdded, logging.ModChangeEntry{Type: logging.ModAdded, Name: name, New: &file}
+	}
+	file.Name = old
+	return EventModDeleted, logging.ModChangeEntry{Type: logging.ModDeleted, Name: old, Old: &file}
+}
@@ -0,0 +1,60 @@
+package ws
+
+import (
+	"testing"
+	"time"
+
+	"github.com/vnxcius/mcpanel-back/internal/logging"
+	"github.com/vnxcius/mcpanel-back/internal/releasenotes"
+)
+
+func TestToggleChangeInReleaseNotes(t *testing.T) {
+	file := logging.ModFile{Name: "ae2.jar", SHA256: "ddd", Version: "15.0"}
+
+	disableEvent, disable := toggleChange("ae2.jar", "ae2.jar.disabled", false, file)
+	disable.Time = "2024-06-01T10:00:00Z"
+	enableEvent, enable := toggleChange("ae2.jar.disabled", "ae2.jar", true, file)
+	enable.Time = "2024-06-02T10:00:00Z"
+
+	if disableEvent != EventModDeleted || enableEvent != EventModAdded {
+		t.Fatalf("got events %q and %q", disableEvent, enableEvent)
+	}
+
+	tests := []struct {
+		name    string
+		entries []logging.ModChangeEntry
+		added   int
+		removed int
+	}{
+		{"disabled", []logging.ModChangeEntry{disable}, 0, 1},
+		{"enabled", []logging.ModChangeEntry{enable}, 1, 0},
+		{"disabled and enabled again", []logging.ModChangeEntry{disable, enable}, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var added, removed []releasenotes.Change
+			for _, d := range releasenotes.Build(tt.entries, time.UTC) {
+				added = append(added, d.Added...)
+				removed = append(removed, d.Removed...)
+				if len(d.Updated) > 0 {
+					t.Fatalf("toggle listed as an update: %+v", d.Updated)
+				}
+			}
+			if len(added) != tt.added || len(removed) != tt.removed {
+				t.Fatalf("got %d added and %d removed, want %d and %d", len(added), len(removed), tt.added, tt.removed)
+			}
+			var files []*logging.ModFile
+			for _, c := range added {
+				files = append(files, c.New)
+			}
+			for _, c := range removed {
+				files = append(files, c.Old)
+			}
+			for _, f := range files {
+				if f.Name != "ae2.jar" || f.Version != "15.0" {
+					t.Fatalf("got file %+v, want the enabled jar", f)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,286 @@
+package ws
+
+import (
+	"encoding/json"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/vnxcius/mcpanel-back/internal/mclog"
+)
+
+const (
+	maxBackfill     = 500
+	maxFilterLength = 256
+)
+
+/*
+ConsoleFilter limits the log entries a client receives. Levels and Logger
+match the parsed entry, Regex the raw text including stack traces. Empty
+fields match everything.
+*/
+type ConsoleFilter struct {
+	Levels []string `json:"levels,omitempty"`
+	Regex  string   `json:"regex,omitempty"`
+	Logger string   `json:"logger,omitempty"`
+
+	re *regexp.Regexp
+}
+
+type ConsoleState struct {
+	Subscribed bool          `json:"subscribed"`
+	Paused     bool          `json:"paused"`
+	Filter     ConsoleFilter `json:"filter"`
+	Position   int           `json:"position"`
+}
+
+type BackfillRequest struct {
+	Before int `json:"before"`
+	Count  int `json:"count"`
+}
+
+type BackfillEvent struct {
+	LogEvent
+	Before  int  `json:"before"`
+	HasMore bool `json:"hasMore"`
+}
+
+/*
+Per client console stream, sent while the client is subscribed to the
+console topic. cursor is the position of the next entry the client should
+get; it stays put while paused so the client catches up on resume.
+*/
+type console struct {
+	sync.Mutex
+	paused bool
+	filter ConsoleFilter
+	cursor int
+}
+
+func (f *ConsoleFilter) compile() error {
+	for i, level := range f.Levels {
+		f.Levels[i] = strings.ToUpper(level)
+	}
+
+	f.re = nil
+	if f.Regex == "" {
+		return nil
+	}
+	if len(f.Regex) > maxFilterLength {
+		return invalidPayload("console filter regex is too long")
+	}
+
+	re, err := regexp.Compile(f.Regex)
+	if err != nil {
+		return invalidPayload("invalid console filter regex")
+	}
+	f.re = re
+	return nil
+}
+
+func (f *ConsoleFilter) match(e mclog.Entry) bool {
+	if len(f.Levels) > 0 && !slices.Contains(f.Levels, e.Level) {
+		return false
+	}
+	if f.Logger != "" && !strings.Contains(strings.ToLower(e.Logger), strings.ToLower(f.Logger)) {
+		return false
+	}
+	if f.re != nil && !slices.ContainsFunc(e.Lines(), f.re.MatchString) {
+		return false
+	}
+	return true
+}
+
+/*
+Sends the client the entries it hasn't seen yet, if it is authenticated,
+subscribed and not paused. The cursor only moves if the event fits in the
+client's queue.
+*/
+func (c *Client) deliverLogs(buf *logBuffer) {
+	c.console.Lock()
+	defer c.console.Unlock()
+
+	if !c.subscribed(TopicConsole) || c.console.paused || c.Tier() < TierAuthenticated {
+		return
+	}
+
+	entries, next, missed := buf.since(c.console.cursor)
+	if len(entries) == 0 && missed == 0 {
+		return
+	}
+	if missed > 0 {
+		c.manager.topics[TopicConsole].dropped.Add(uint64(missed))
+	}
+
+	kept := []LogEntry{}
+	for _, e := range entries {
+		if c.console.filter.match(e.Entry) {
+			kept = append(kept, e)
+		}
+	}
+	if len(kept) == 0 && missed == 0 {
+		c.console.cursor = next
+		return
+	}
+
+	evt := newLogEvent(kept)
+	evt.Missed = missed
+	payload, err := json.Marshal(evt)
+	if err != nil {
+		slog.Error("Error marshalling log event", "error", err)
+		return
+	}
+
+	select {
+	case c.egress <- Event{Type: EventLogAppend, Payload: payload, logNext: next}:
+		c.console.cursor = next
+	default:
+		slog.Warn("client buffer full, delaying log entries")
+	}
+}
+
+func (c *Client) consoleState() ConsoleState {
+	return ConsoleState{
+		Subscribed: c.subscribed(TopicConsole),
+		Paused:     c.console.paused,
+		Filter:     c.console.filter,
+		Position:   c.console.cursor,
+	}
+}
+
+// Replies with the client's console settings after they change
+func (c *Client) sendConsoleState() {
+	c.console.Lock()
+	state := c.consoleState()
+	c.console.Unlock()
+
+	payload, err := json.Marshal(state)
+	if err != nil {
+		slog.Error("Error marshalling console state", "error", err)
+		return
+	}
+	c.send(Event{Type: EventConsoleState, Payload: payload})
+}
+
+func consoleSubscribeHandler(event Event, c *Client) (any, error) {
+	var req struct {
+		Filter *ConsoleFilter `json:"filter"`
+	}
+	if len(event.Payload) > 0 {
+		if err := json.Unmarshal(event.Payload, &req); err != nil {
+			return nil, err
+		}
+	}
+	if req.Filter != nil {
+		if err := req.Filter.compile(); err != nil {
+			return nil, err
+		}
+	}
+
+	c.startConsole()
+	if req.Filter != nil {
+		c.console.Lock()
+		c.console.filter = *req.Filter
+		c.console.Unlock()
+	}
+
+	c.sendConsoleState()
+	return nil, nil
+}
+
+// Subscribes to the console topic, from the newest entry if not already
+func (c *Client) startConsole() {
+	c.console.Lock()
+	defer c.console.Unlock()
+
+	if !c.subscribed(TopicConsole) {
+		// new entries only, older ones can be backfilled
+		c.console.cursor = c.manager.logs.end()
+	}
+	c.setSubscribed(TopicConsole, true)
+	c.console.paused = false
+}
+
+func consoleUnsubscribeHandler(event Event, c *Client) (any, error) {
+	c.console.Lock()
+	c.setSubscribed(TopicConsole, false)
+	c.console.Unlock()
+
+	c.sendConsoleState()
+	return nil, nil
+}
+
+func consoleFilterHandler(event Event, c *Client) (any, error) {
+	var filter ConsoleFilter
+	if len(event.Payload) > 0 {
+		if err := json.Unmarshal(event.Payload, &filter); err != nil {
+			return nil, err
+		}
+	}
+	if err := filter.compile(); err != nil {
+		return nil, err
+	}
+
+	c.console.Lock()
+	c.console.filter = filter
+	c.console.Unlock()
+
+	c.sendConsoleState()
+	return nil, nil
+}
+
+func consolePauseHandler(event Event, c *Client) (any, error) {
+	c.console.Lock()
+	c.console.paused = true
+	c.console.Unlock()
+
+	c.sendConsoleState()
+	return nil, nil
+}
+
+func consoleResumeHandler(event Event, c *Client) (any, error) {
+	c.console.Lock()
+	c.console.paused = false
+	c.console.Unlock()
+
+	c.sendConsoleState()
+	return nil, nil
+}
+
+/*
+Sends up to count entries from before the given position, matching the
+client's filter. A missing position means the end of the buffer.
+*/
+func consoleBackfillHandler(event Event, c *Client) (any, error) {
+	var req BackfillRequest
+	if len(event.Payload) > 0 {
+		if err := json.Unmarshal(event.Payload, &req); err != nil {
+			return nil, err
+		}
+	}
+	if req.Before <= 0 {
+		req.Before = c.manager.logs.end()
+	}
+	if req.Count < 1 || req.Count > maxBackfill {
+		req.Count = maxBackfill
+	}
+
+	c.console.Lock()
+	filter := c.console.filter
+	c.console.Unlock()
+
+	entries, hasMore := c.manager.logs.before(req.Before, req.Count, filter.match)
+	payload, err := json.Marshal(BackfillEvent{
+		LogEvent: newLogEvent(entries),
+		Before:   req.Before,
+		HasMore:  hasMore,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c.send(Event{Type: EventLogBackfill, Payload: payload})
+	return nil, nil
+}
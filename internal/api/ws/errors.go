@@ -0,0 +1,119 @@
+package ws
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+/*
+ProtocolVersion is the websocket protocol this server speaks, agreed on
+when connecting with ?protocol=. Future versions are added to
+SupportedProtocols and checked through Client.protocol.
+*/
+const ProtocolVersion = 1
+
+var SupportedProtocols = []int{ProtocolVersion}
+
+// ErrorCode tells clients why a request failed without parsing the message
+type ErrorCode string
+
+const (
+	// the frame isn't a JSON event
+	CodeInvalidMessage ErrorCode = "invalid_message"
+	CodeUnknownEvent   ErrorCode = "unknown_event"
+	// the payload doesn't fit the event
+	CodeInvalidPayload  ErrorCode = "invalid_payload"
+	CodeUnauthenticated ErrorCode = "unauthenticated"
+	// the server is in a state that doesn't allow the request
+	CodeConflict ErrorCode = "conflict"
+	CodeFailed   ErrorCode = "failed"
+)
+
+/*
+ErrorEvent answers a request that failed. ID and Type are those of the
+request, empty if it couldn't be read.
+*/
+type ErrorEvent struct {
+	ID      string    `json:"id,omitempty"`
+	Type    string    `json:"type,omitempty"`
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+}
+
+// Error is a request error with the code clients get for it
+type Error struct {
+	Code ErrorCode
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func invalidPayload(message string) error {
+	return &Error{Code: CodeInvalidPayload, Err: errors.New(message)}
+}
+
+func errorCode(err error) ErrorCode {
+	var (
+		wsErr     *Error
+		syntaxErr *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+	)
+	switch {
+	case errors.As(err, &wsErr):
+		return wsErr.Code
+	case errors.As(err, &syntaxErr), errors.As(err, &typeErr):
+		return CodeInvalidPayload
+	case errors.Is(err, errNotAuthenticated), errors.Is(err, errSessionExpired):
+		return CodeUnauthenticated
+	case errors.Is(err, ErrBackupRunning), errors.Is(err, ErrAlreadyOnline),
+		errors.Is(err, ErrAlreadyOffline), errors.Is(err, ErrServerBusy):
+		return CodeConflict
+	}
+	return CodeFailed
+}
+
+/*
+Picks the protocol version for a connection from the comma separated
+versions the client speaks, the newest one both sides support. An empty
+list means the current version.
+*/
+func NegotiateProtocol(value string) (int, error) {
+	if value == "" {
+		return ProtocolVersion, nil
+	}
+
+	version := 0
+	for _, v := range strings.Split(value, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			return 0, fmt.Errorf("invalid protocol version %q", v)
+		}
+		if slices.Contains(SupportedProtocols, n) {
+			version = max(version, n)
+		}
+	}
+	if version == 0 {
+		return 0, fmt.Errorf("unsupported protocol version %s, supported: %v", value, SupportedProtocols)
+	}
+	return version, nil
+}
+
+func (c *Client) sendError(request Event, err error) {
+	payload, _ := json.Marshal(ErrorEvent{
+		ID:      request.ID,
+		Type:    request.Type,
+		Code:    errorCode(err),
+		Message: err.Error(),
+	})
+	c.send(Event{ID: request.ID, Type: EventError, Payload: payload})
+}
@@ -2,25 +2,61 @@ package ws
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"log/slog"
 	"os"
 	"os/exec"
+	"slices"
 	"time"
 
+	"github.com/vnxcius/mcpanel-back/internal/backup"
+	"github.com/vnxcius/mcpanel-back/internal/logging"
 	"github.com/vnxcius/mcpanel-back/internal/utils"
 )
 
+/*
+Event is a websocket frame. ID is optional and set by clients on requests;
+acks and error frames carry it back so they can be matched. Seq numbers published events,
+replies to a single client have none.
+*/
 type Event struct {
+	ID      string          `json:"id,omitempty"`
+	Seq     uint64          `json:"seq,omitempty"`
 	Type    string          `json:"type"`
 	Payload json.RawMessage `json:"payload"`
+
+	// position after the entries of a log_append, for event streams
+	logNext int
+	// encoded frames, shared by the clients of a published event
+	frames *frames
 }
 
 type StatusUpdateEvent struct {
 	Status string `json:"status"`
 }
 
-type EventHandler func(event Event, c *Client) error
+/*
+EventHandler handles a client request. A non-nil result is sent back in an
+ack, an error in an error frame.
+*/
+type EventHandler func(event Event, c *Client) (any, error)
+
+// events sent by clients, all but the changelog pages need authentication
+const (
+	EventConsoleSubscribe   = "console_subscribe"
+	EventConsoleUnsubscribe = "console_unsubscribe"
+	EventConsoleFilter      = "console_filter"
+	EventConsolePause       = "console_pause"
+	EventConsoleResume      = "console_resume"
+	EventConsoleBackfill    = "console_backfill"
+
+	EventServerStart    = "server_start"
+	EventServerStop     = "server_stop"
+	EventServerRestart  = "server_restart"
+	EventConsoleCommand = "console_command"
+	EventModToggle      = "mod_toggle"
+)
 
 const (
 	EventStatusUpdate     = "status_update"
@@ -29,32 +65,57 @@ const (
 	EventModUpdated       = "mod_updated"
 	EventModlist          = "modlist"
 	EventModlistChangelog = "modlist_changelog"
+	EventChangelogAppend  = "modlist_changelog_append"
+	EventChangelogPage    = "modlist_changelog_page"
 	EventLogAppend        = "log_append"
 	EventLogSnapshot      = "log_snapshot"
+	EventLogBackfill      = "log_backfill"
+	EventConsoleState     = "console_state"
+	EventConfigChanged    = "config_changed" // on TopicConfig, for config files and server.properties
+	EventBackupProgress   = "backup_progress"
+	EventPlayerListChange = "player_list_changed"
+	EventPlayerJoined     = "player_joined"
+	EventPlayerLeft       = "player_left"
+	EventServerCrashed    = "server_crashed"
+	EventAlert            = "alert"
+	EventPlayerCount      = "player_count"
+	EventSession          = "session"
+	EventAck              = "ack"
+	EventError            = "error"
 )
 
-func simulateOperation(startStatus, endStatus string, delay time.Duration) {
-	Manager.SetStatus(startStatus)
-	time.Sleep(delay)
-	Manager.SetStatus(endStatus)
+// events only authenticated clients receive, the others are public
+var authenticatedEvents = []string{
+	EventLogAppend,
+	EventLogSnapshot,
+	EventLogBackfill,
+	EventConsoleState,
+	EventConfigChanged,
+	EventBackupProgress,
+	EventPlayerListChange,
+	EventPlayerJoined,
+	EventPlayerLeft,
+	EventServerCrashed,
+	EventAlert,
 }
 
-// Start -> Online in 2s
-func simulateStart() {
-	slog.Info("Simulating server start...")
-	go simulateOperation("starting", "online", 2*time.Second)
+func eventTier(eventType string) Tier {
+	if slices.Contains(authenticatedEvents, eventType) {
+		return TierAuthenticated
+	}
+	return TierPublic
 }
 
-// Stop -> Offline in 2s
-func simulateStop() {
-	slog.Info("Simulating server stop...")
-	go simulateOperation("stopping", "offline", 2*time.Second)
-}
+var (
+	ErrBackupRunning  = errors.New("Um backup ou restauração está em andamento")
+	ErrAlreadyOnline  = errors.New("O servidor já está ligado ou iniciando")
+	ErrAlreadyOffline = errors.New("O servidor já está desligado ou parando")
+	ErrServerBusy     = errors.New("O servidor está ocupado em outra operação")
+)
 
-// Restart -> Online in 2s
-func simulateRestart() {
-	slog.Info("Simulating server restart...")
-	go simulateOperation("restarting", "online", 2*time.Second)
+func simulateOperation(endStatus string, delay time.Duration) {
+	time.Sleep(delay)
+	Manager.SetStatus(endStatus)
 }
 
 func runServerScript(action string) error {
@@ -78,44 +139,97 @@ func (m *WSManager) SetStatus(status string) {
 	m.currentStatus = status
 	m.Unlock()
 
+	if status == "offline" {
+		m.tracker.Reset(time.Now())
+	}
+
 	payload, err := json.Marshal(StatusUpdateEvent{Status: status})
 	if err != nil {
 		slog.Error("Error marshalling message", "error", err)
 		return
 	}
-	m.broadcast(Event{
+	m.publish(TopicStatus, Event{
 		Type:    EventStatusUpdate,
 		Payload: payload,
-	})
+	}, nil)
+	if status == "offline" {
+		m.broadcastPlayerCount()
+	}
 
 	slog.Info("Server status updated", "status", status)
 }
 
-func (m *WSManager) UpdateModlist(eventType string, payload json.RawMessage) {
-	m.broadcast(Event{
+// Sends a mod change, without its actor to public clients
+func (m *WSManager) UpdateModlist(eventType string, change logging.ModChangeEntry) {
+	change.IP = ""
+	payload, err := json.Marshal(change)
+	if err != nil {
+		slog.Error("Error marshalling message", "error", err)
+		return
+	}
+	redacted, _ := json.Marshal(change.Redacted())
+
+	m.publish(TopicMods, Event{
 		Type:    eventType,
 		Payload: payload,
-	})
-
-	// Update modlist changelog
-	modlistChangelog, err := utils.GetModlistChangelog()
-	if err == nil {
-		payload, _ := json.Marshal(modlistChangelog)
-		m.broadcast(Event{
-			Type:    EventModlistChangelog,
-			Payload: payload,
-		})
+	}, redacted)
+	m.appendChangelog(change)
+}
+
+// Tells why the server can't be started right now, if it can't
+func (m *WSManager) CheckStart() error {
+	if backup.Backups.Busy() {
+		return ErrBackupRunning
+	}
+	if status := m.GetStatus(); status == "online" || status == "starting" {
+		return ErrAlreadyOnline
+	}
+	return nil
+}
+
+// Tells why the server can't be stopped right now, if it can't
+func (m *WSManager) CheckStop() error {
+	if status := m.GetStatus(); status == "offline" || status == "stopping" {
+		return ErrAlreadyOffline
 	}
+	return nil
 }
 
-func (m *WSManager) StartServer() {
+// Tells why the server can't be restarted right now, if it can't
+func (m *WSManager) CheckRestart() error {
+	if backup.Backups.Busy() {
+		return ErrBackupRunning
+	}
+	if status := m.GetStatus(); status != "online" && status != "offline" {
+		return ErrServerBusy
+	}
+	return nil
+}
+
+/*
+Moves the server out of offline while no backup job can start, so a
+restore never runs under a starting server.
+*/
+func (m *WSManager) leaveOffline(status string) error {
+	if err := backup.Backups.WhileIdle(func() { m.SetStatus(status) }); err != nil {
+		return ErrBackupRunning
+	}
+	return nil
+}
+
+func (m *WSManager) StartServer() error {
+	if err := m.leaveOffline("starting"); err != nil {
+		return err
+	}
+
 	go func() {
 		if os.Getenv("ENVIRONMENT") != "production" {
-			simulateStart()
+			// Start -> Online in 2s
+			slog.Info("Simulating server start...")
+			simulateOperation("online", 2*time.Second)
 			return
 		}
 
-		m.SetStatus("starting")
 		if err := runServerScript("start"); err != nil {
 			slog.Error("Failed to start server", "error", err)
 			m.SetStatus("offline")
@@ -130,16 +244,20 @@ func (m *WSManager) StartServer() {
 
 		m.SetStatus("online")
 	}()
+	return nil
 }
 
 func (m *WSManager) StopServer() {
+	m.SetStatus("stopping")
+
 	go func() {
 		if os.Getenv("ENVIRONMENT") != "production" {
-			simulateStop()
+			// Stop -> Offline in 2s
+			slog.Info("Simulating server stop...")
+			simulateOperation("offline", 2*time.Second)
 			return
 		}
 
-		m.SetStatus("stopping")
 		if err := runServerScript("stop"); err != nil {
 			slog.Error("Failed to stop server:", "error", err)
 			m.SetStatus("online")
@@ -156,14 +274,19 @@ func (m *WSManager) StopServer() {
 	}()
 }
 
-func (m *WSManager) RestartServer() {
+func (m *WSManager) RestartServer() error {
+	if err := m.leaveOffline("restarting"); err != nil {
+		return err
+	}
+
 	go func() {
 		if os.Getenv("ENVIRONMENT") != "production" {
-			simulateRestart()
+			// Restart -> Online in 2s
+			slog.Info("Simulating server restart...")
+			simulateOperation("online", 2*time.Second)
 			return
 		}
 
-		m.SetStatus("restarting")
 		if err := runServerScript("restart"); err != nil {
 			slog.Error("Failed to restart server:", "error", err)
 			m.SetStatus("online")
@@ -178,4 +301,5 @@ func (m *WSManager) RestartServer() {
 
 		m.SetStatus("online")
 	}()
+	return nil
 }
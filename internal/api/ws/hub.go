@@ -1,6 +1,8 @@
 package ws
 
 import (
+	"cmp"
+	"compress/flate"
 	"context"
 	"encoding/json"
 	"errors"
@@ -10,13 +12,18 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"testing"
 	"time"
 
 	"slices"
 
 	"github.com/gorilla/websocket"
 	"github.com/joho/godotenv"
+	"github.com/vnxcius/mcpanel-back/internal/api/middleware"
+	"github.com/vnxcius/mcpanel-back/internal/logging"
+	"github.com/vnxcius/mcpanel-back/internal/mclog"
 	"github.com/vnxcius/mcpanel-back/internal/otp"
+	"github.com/vnxcius/mcpanel-back/internal/players"
 	"github.com/vnxcius/mcpanel-back/internal/utils"
 )
 
@@ -24,27 +31,44 @@ type WSManager struct {
 	clients ClientList
 	sync.RWMutex
 	handlers map[string]EventHandler
-	otps     otp.RetentionMap
+	otps     *otp.RetentionMap
+	tracker  *players.Tracker
+	logs     *logBuffer
+	topics   map[Topic]*topicCounters
+	replay   *replayRing
+
+	// held while publishing, so events reach clients in seq order
+	publishing sync.Mutex
+
+	logListeners []func(mclog.Entry)
 
 	currentStatus string
 }
 
+const (
+	// tickets are meant to be used right after being issued
+	ticketMaxAge = time.Minute
+	// how often the sessions of connected clients are checked
+	sessionCheckInterval = time.Minute
+)
+
 var (
 	WebsocketUpgrader = websocket.Upgrader{
-		ReadBufferSize:  1024,
-		WriteBufferSize: 1024,
-		CheckOrigin:     checkOrigin,
+		ReadBufferSize:    1024,
+		WriteBufferSize:   1024,
+		CheckOrigin:       checkOrigin,
+		EnableCompression: true,
+		Subprotocols:      Subprotocols,
 	}
 
 	Manager        *WSManager
 	logsPath       string
 	allowedOrigins []string
-
-	once sync.Once
 )
 
 func init() {
-	if err := godotenv.Load(); err != nil {
+	// tests run without the deployment's .env
+	if err := godotenv.Load(); err != nil && !testing.Testing() {
 		log.Fatal("Error loading .env file in ws: ", err)
 	}
 
@@ -69,75 +93,208 @@ func newManager(ctx context.Context) *WSManager {
 	if utils.IsMinecraftCurrentlyOnline() {
 		status = "online"
 	}
-	return &WSManager{
+
+	tracker := players.NewTracker(os.Getenv("PLAYER_TRACK_IPS") == "true")
+	tracker.Resume(status == "online")
+
+	m := &WSManager{
 		clients:       make(ClientList),
 		handlers:      make(map[string]EventHandler),
 		currentStatus: status,
-		otps:          otp.NewRetentionMap(ctx, 5*time.Minute),
+		otps:          otp.NewRetentionMap(ctx, ticketMaxAge),
+		tracker:       tracker,
+		logs:          newLogBuffer(logBacklog),
+		topics:        newTopicCounters(),
+		replay:        newReplayRing(),
 	}
+	m.setupEventHandlers()
+	return m
 }
 
-func InitializeManager() {
-	//TODO: pass context
-	Manager = newManager(context.Background())
+func (m *WSManager) setupEventHandlers() {
+	m.handlers[EventSubscribe] = subscribeHandler
+	m.handlers[EventUnsubscribe] = unsubscribeHandler
+	m.handlers[EventChangelogPage] = changelogPageHandler
+	m.handlers[EventConsoleSubscribe] = authenticated(consoleSubscribeHandler)
+	m.handlers[EventConsoleUnsubscribe] = authenticated(consoleUnsubscribeHandler)
+	m.handlers[EventConsoleFilter] = authenticated(consoleFilterHandler)
+	m.handlers[EventConsolePause] = authenticated(consolePauseHandler)
+	m.handlers[EventConsoleResume] = authenticated(consoleResumeHandler)
+	m.handlers[EventConsoleBackfill] = authenticated(consoleBackfillHandler)
+
+	m.handlers[EventServerStart] = authenticated(serverStartHandler)
+	m.handlers[EventServerStop] = authenticated(serverStopHandler)
+	m.handlers[EventServerRestart] = authenticated(serverRestartHandler)
+	m.handlers[EventConsoleCommand] = authenticated(consoleCommandHandler)
+	m.handlers[EventModToggle] = authenticated(modToggleHandler)
 }
 
-func (m *WSManager) AddClient(conn *websocket.Conn, ip string) {
-	once.Do(func() {
-		tailLogs()
-	})
-	c := NewClient(conn, m, ip)
+/*
+Creates the manager and starts following the Minecraft log, which player
+tracking needs even with no clients connected. Both stop when ctx is done.
+*/
+func InitializeManager(ctx context.Context) {
+	Manager = newManager(ctx)
+	go Manager.checkSessions(ctx)
 
-	m.Lock()
-	m.clients[c] = true
-	m.Unlock()
+	if logsPath == "" {
+		slog.Warn("LOGS_PATH is not set, the console and player tracking are disabled")
+		return
+	}
+	Manager.tailLogs(ctx)
+}
+
+/*
+ClientOptions describes a new connection. Actor is nil for anonymous
+clients, Session the token the client stays authenticated with. Since is
+the seq of the last event a reconnecting client got and Position the log
+position it expects next, used only when the missed events can be
+replayed; zero means a fresh session. Protocol is the version agreed on,
+the current one if zero.
+*/
+type ClientOptions struct {
+	IP       string
+	Actor    *logging.Actor
+	Session  string
+	Topics   []Topic
+	Since    uint64
+	Position int
+	Protocol int
+}
+
+/*
+Registers a websocket connection. Frames are deflated at the fastest level
+when the client negotiated permessage-deflate, the console stream sends a
+lot of them.
+*/
+func (m *WSManager) AddClient(conn *websocket.Conn, opts ClientOptions) {
+	if err := conn.SetCompressionLevel(flate.BestSpeed); err != nil {
+		slog.Warn("Failed to set websocket compression level", "error", err)
+	}
+	c := NewClient(conn, m, opts.IP)
+	m.register(c, opts)
 
 	go m.syncWithMinecraft()
 	go c.WriteMessages()
 	go c.ReadMessages()
+}
 
-	// update server status
-	statusPayload, _ := json.Marshal(StatusUpdateEvent{
-		Status: m.GetStatus(),
+/*
+Adds a client to the hub. Anonymous clients can watch but not control the
+server. The client starts subscribed to its topics, minus those its tier
+can't see. A reconnecting client gets the events it missed if they are all
+still kept, any other client a snapshot of each topic. Returns the seq and
+log position the client starts from.
+*/
+func (m *WSManager) register(c *Client, opts ClientOptions) (uint64, int) {
+	c.actor = opts.Actor
+	c.session = opts.Session
+	c.protocol = cmp.Or(opts.Protocol, ProtocolVersion)
+	c.subscribe(opts.Topics)
+
+	// the snapshot covers everything up to here, new entries come from
+	// the console stream
+	snapshot, next, _ := m.logs.since(max(m.logs.end()-logSnapshotSize, 0))
+	c.console.cursor = next
+	sendLogs := true
+
+	// nothing can be published between the replay and joining the clients
+	m.publishing.Lock()
+	var (
+		missed  []Event
+		resumed bool
+	)
+	if opts.Since > 0 {
+		missed, resumed = c.missedEvents(opts.Since)
+	}
+	// positions only mean something to a client this hub has seen, one
+	// from before a restart would skip or repeat entries
+	if resumed && opts.Position > 0 && m.logs.has(opts.Position) {
+		// the console stream picks up where the client left off
+		c.console.cursor = opts.Position
+		sendLogs = false
+	}
+	cursor := c.console.cursor
+
+	m.Lock()
+	m.clients[c] = true
+	m.Unlock()
+
+	seq := m.replay.last()
+	sessionPayload, _ := json.Marshal(SessionEvent{
+		Authenticated: opts.Actor != nil,
+		Actor:         opts.Actor,
+		Seq:           seq,
+		Resumed:       resumed,
+		Protocol:      c.protocol,
 	})
 	c.send(Event{
-		Type:    EventStatusUpdate,
-		Payload: statusPayload,
+		Type:    EventSession,
+		Payload: sessionPayload,
 	})
+	c.sendSubscriptions()
+	for _, evt := range missed {
+		c.send(evt)
+	}
+	m.publishing.Unlock()
 
-	// update modlist
-	modPayload, err := utils.GetMods()
-	if err == nil {
+	if resumed {
+		if sendLogs && c.subscribed(TopicConsole) {
+			c.sendLogSnapshot(snapshot)
+		}
+		return seq, cursor
+	}
+
+	// update server status
+	if c.subscribed(TopicStatus) {
+		statusPayload, _ := json.Marshal(StatusUpdateEvent{
+			Status: m.GetStatus(),
+		})
 		c.send(Event{
-			Type:    EventModlist,
-			Payload: modPayload,
+			Type:    EventStatusUpdate,
+			Payload: statusPayload,
 		})
-	} else {
-		slog.Error("Failed to get mod list on client connect", "error", err)
 	}
 
-	// send log snapshot
-	logSnapshot, err := getLastLogLines(350)
-	if err == nil {
-		payload, _ := json.Marshal(struct {
-			Lines []string `json:"lines"`
-		}{Lines: logSnapshot})
+	// update modlist
+	if c.subscribed(TopicMods) {
+		modPayload, err := utils.GetMods()
+		if err == nil {
+			c.send(Event{
+				Type:    EventModlist,
+				Payload: modPayload,
+			})
+		} else {
+			slog.Error("Failed to get mod list on client connect", "error", err)
+		}
+	}
 
+	if c.subscribed(TopicPlayers) {
+		playerPayload, _ := json.Marshal(m.playerCount())
 		c.send(Event{
-			Type:    EventLogSnapshot,
-			Payload: payload,
+			Type:    EventPlayerCount,
+			Payload: playerPayload,
 		})
 	}
 
-	// changelog
-	modlistChangelog, err := utils.GetModlistChangelog()
-	if err == nil {
-		payload, _ := json.Marshal(modlistChangelog)
-		c.send(Event{
-			Type:    EventModlistChangelog,
-			Payload: payload,
-		})
+	// send log snapshot
+	if sendLogs && c.subscribed(TopicConsole) {
+		c.sendLogSnapshot(snapshot)
 	}
+
+	// latest changelog page, older ones are requested by the client
+	if c.subscribed(TopicChangelog) {
+		c.sendChangelogPage(EventModlistChangelog, 0, changelogPageSize)
+	}
+	return seq, cursor
+}
+
+func (c *Client) sendLogSnapshot(entries []LogEntry) {
+	payload, _ := json.Marshal(newLogEvent(entries))
+	c.send(Event{
+		Type:    EventLogSnapshot,
+		Payload: payload,
+	})
 }
 
 func (m *WSManager) RemoveClient(c *Client) {
@@ -145,34 +302,74 @@ func (m *WSManager) RemoveClient(c *Client) {
 	defer m.Unlock()
 
 	if _, ok := m.clients[c]; ok {
-		c.connection.Close()
+		if c.connection != nil {
+			c.connection.Close()
+		}
+		close(c.done)
 		delete(m.clients, c)
 	}
 }
 
-func (m *WSManager) routeEvent(event Event, c *Client) error {
-	if handler, ok := m.handlers[event.Type]; ok {
-		if err := handler(event, c); err != nil {
-			return err
-		}
-		return nil
-	} else {
-		return errors.New("Unknown event type: " + event.Type)
+/*
+Disconnects a client whose session ended. Websockets get a close frame
+saying so before the connection is dropped.
+*/
+func (m *WSManager) expireSession(c *Client) {
+	slog.Info("Session ended, disconnecting client", "ip", c.ip, "actor", c.actor.Name)
+	if c.connection != nil {
+		msg := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, errSessionExpired.Error())
+		_ = c.connection.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
 	}
+	m.RemoveClient(c)
 }
 
-func (m *WSManager) broadcast(evt Event) {
-	m.RLock()
-	defer m.RUnlock()
+/*
+Checks the sessions of authenticated clients every sessionCheckInterval,
+so a logged out client stops getting the console even if it never sends
+anything. Stops when ctx is done.
+*/
+func (m *WSManager) checkSessions(ctx context.Context) {
+	ticker := time.NewTicker(sessionCheckInterval)
+	defer ticker.Stop()
 
-	for c := range m.clients {
+	for {
 		select {
-		case c.egress <- evt:
-			slog.Debug("Broadcasting event", "type", evt.Type)
-		default:
-			slog.Warn("client buffer full, dropping event")
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
 		}
+
+		bySession := map[string][]*Client{}
+		m.RLock()
+		for c := range m.clients {
+			if c.session != "" {
+				bySession[c.session] = append(bySession[c.session], c)
+			}
+		}
+		m.RUnlock()
+
+		for session, clients := range bySession {
+			active, err := middleware.SessionActive(session)
+			if err != nil {
+				slog.Error("Failed to check websocket session", "error", err)
+				break
+			}
+			if active {
+				continue
+			}
+			for _, c := range clients {
+				m.expireSession(c)
+			}
+		}
+	}
+}
+
+func (m *WSManager) routeEvent(event Event, c *Client) (any, error) {
+	handler, ok := m.handlers[event.Type]
+	if !ok {
+		return nil, &Error{Code: CodeUnknownEvent, Err: errors.New("unknown event type: " + event.Type)}
 	}
+	return handler(event, c)
 }
 
 func (m *WSManager) syncWithMinecraft() {
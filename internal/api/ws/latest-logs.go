@@ -1,170 +1,238 @@
 package ws
 
 import (
-	"bufio"
-	"encoding/json"
-	"io"
-	"log"
+	"context"
 	"log/slog"
 	"os"
 	"path/filepath"
-	"strings"
+	"slices"
 	"sync"
 	"time"
+
+	"github.com/vnxcius/mcpanel-back/internal/mclog"
 )
 
+/*
+Keeps the latest log entries for snapshots, backfills and clients catching
+up after a pause. Every entry gets a position, counting from the first one
+read since startup.
+*/
 type logBuffer struct {
 	sync.Mutex
-	buf   []string
+	buf   []mclog.Entry
 	total int
+	max   int
 }
 
-func getLastLogLines(n int) ([]string, error) {
-	slog.Debug("Getting last log lines", "path", logsPath, "n", n)
-	file, err := os.Open(filepath.Clean(logsPath))
-	if err != nil {
-		return nil, err
-	}
-	defer file.Close()
-
-	lines := []string{}
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		lines = append(lines, scanner.Text())
-	}
-
-	if len(lines) > n {
-		lines = lines[len(lines)-n:]
-	}
-	return lines, nil
+// LogEntry is a log entry along with its position in the buffer
+type LogEntry struct {
+	Position int `json:"position"`
+	mclog.Entry
 }
 
-func tailLogs() {
-	slog.Info("Starting tailLogs")
-	lines := make(chan string, 1000)
-	go tailFile(logsPath, lines)
-
-	const maxLines = 350
-	buf := &logBuffer{}
-
-	go startProducer(lines, buf, maxLines)
-	go startConsumer(buf)
+// Payload of log_snapshot and log_append. Lines keeps the raw text for
+// older clients, Entries has the same lines parsed. Missed counts entries
+// that left the buffer before a paused client could get them.
+type LogEvent struct {
+	Lines   []string   `json:"lines"`
+	Entries []LogEntry `json:"entries"`
+	Missed  int        `json:"missed,omitempty"`
 }
 
-func tailFile(filePath string, lines chan<- string) {
-	slog.Debug("Starting log tailing", "path", filePath)
-	file, fi := openLog(filePath)
-	defer file.Close()
-
-	lastMod, offset := fi.ModTime(), fi.Size()
-	file.Seek(0, io.SeekEnd)
-
-	for {
-		time.Sleep(time.Second)
-		currentFi, err := os.Stat(filePath)
-		if err != nil {
-			log.Printf("file missing, waiting for recreation...")
-			continue
-		}
-
-		if rotated(currentFi, lastMod, offset) {
-			slog.Debug("Log file rotated, restarting tailing", "path", filePath)
-			file.Close()
-			file, fi = openLog(filePath)
-			lastMod, offset = fi.ModTime(), 0
-			continue
-		}
+const (
+	// entries kept in memory for backfills
+	logBacklog = 5000
+	// entries sent to clients when they connect
+	logSnapshotSize = 350
+	// an entry is sent once no continuation line arrived for this long
+	entryFlushDelay = 500 * time.Millisecond
+)
 
-		offset, lastMod = readNew(file, currentFi, offset, lines)
+func newLogEvent(entries []LogEntry) LogEvent {
+	evt := LogEvent{Lines: []string{}, Entries: entries}
+	for _, e := range entries {
+		evt.Lines = append(evt.Lines, e.Lines()...)
 	}
+	return evt
 }
 
-func openLog(path string) (*os.File, os.FileInfo) {
-	f, err := os.Open(path)
+func getLastLogEntries(n int) ([]mclog.Entry, error) {
+	lines, err := getLastLogLines(n)
 	if err != nil {
-		log.Fatalf("failed to open file: %v", err)
+		return nil, err
 	}
-	fi, err := f.Stat()
-	if err != nil {
-		log.Fatalf("failed to get file stats: %v", err)
+
+	lastDay := time.Now()
+	if fi, err := os.Stat(logsPath); err == nil {
+		lastDay = fi.ModTime()
 	}
-	return f, fi
+	return mclog.ParseTail(lines, lastDay), nil
 }
 
-func rotated(fi os.FileInfo, lastModified time.Time, offset int64) bool {
-	return fi.ModTime().Before(lastModified) || fi.Size() < offset
+func getLastLogLines(n int) ([]string, error) {
+	slog.Debug("Getting last log lines", "path", logsPath, "n", n)
+	return mclog.LastLines(filepath.Clean(logsPath), n)
 }
 
-func readNew(f *os.File, fi os.FileInfo, offset int64, out chan<- string) (int64, time.Time) {
-	if fi.Size() <= offset {
-		return offset, fi.ModTime()
+/*
+Follows the Minecraft log until ctx is done, feeding the player tracker
+and sending new entries to subscribed clients once a second.
+*/
+func (m *WSManager) tailLogs(ctx context.Context) {
+	slog.Info("Starting log tailing", "path", logsPath)
+	lines := make(chan string, 1000)
+
+	// start from what is already in the file so there is something to
+	// show and backfill right away
+	if entries, err := getLastLogEntries(logBacklog); err == nil {
+		for _, e := range entries {
+			m.logs.append(e)
+		}
 	}
 
-	f.Seek(offset, io.SeekStart)
-	buf := make([]byte, fi.Size()-offset)
+	go mclog.Tail(ctx, logsPath, lines)
 
-	n, err := f.Read(buf)
-	if err != nil && err != io.EOF {
-		log.Fatalf("failed to read file: %v", err)
-	}
+	go m.startProducer(ctx, lines)
+	go m.startConsumer(ctx)
+}
 
-	lines := strings.Split(strings.ReplaceAll(string(buf[:n]), "\r\n", "\n"), "\n")
-	for _, line := range lines {
+func (m *WSManager) startProducer(ctx context.Context, src <-chan string) {
+	assembler := mclog.NewAssembler(time.Now())
+	ticker := time.NewTicker(entryFlushDelay)
+	defer ticker.Stop()
+
+	lastLine := time.Now()
+	for {
 		select {
-		case out <- line:
-		default: // drop if channel is full
-			slog.Warn("Log channel full, dropping line")
+		case <-ctx.Done():
+			return
+		case line := <-src:
+			if line == "" {
+				continue
+			}
+			lastLine = time.Now()
+			if e, ok := assembler.Add(line); ok {
+				m.addLogEntry(e)
+			}
+			m.trackPlayers(line)
+		case <-ticker.C:
+			if time.Since(lastLine) < entryFlushDelay {
+				continue
+			}
+			if e, ok := assembler.Flush(); ok {
+				m.addLogEntry(e)
+			}
 		}
 	}
-
-	return fi.Size(), fi.ModTime()
 }
 
-func startProducer(src <-chan string, dst *logBuffer, max int) {
-	for line := range src {
-		dst.append(line, max)
+func (m *WSManager) addLogEntry(e mclog.Entry) {
+	m.logs.append(e)
+	m.topics[TopicConsole].published.Add(1)
+
+	m.RLock()
+	listeners := m.logListeners
+	m.RUnlock()
+	for _, fn := range listeners {
+		fn(e)
 	}
 }
 
-func startConsumer(buf *logBuffer) {
+/*
+Registers fn to be called with every new entry of the tailed log. It runs
+on the tailing goroutine, so it must not block.
+*/
+func (m *WSManager) AddLogListener(fn func(mclog.Entry)) {
+	m.Lock()
+	m.logListeners = append(m.logListeners, fn)
+	m.Unlock()
+}
+
+func (m *WSManager) startConsumer(ctx context.Context) {
 	ticker := time.NewTicker(time.Second)
 	defer ticker.Stop()
 
-	var lastSent int
-	for range ticker.C {
-		lines, total := buf.pending(lastSent)
-		if len(lines) == 0 {
-			continue
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
 		}
-		payload, _ := json.Marshal(struct {
-			Lines []string `json:"lines"`
-		}{Lines: lines})
 
-		Manager.broadcast(Event{Type: EventLogAppend, Payload: payload})
-		lastSent = total
+		m.RLock()
+		for c := range m.clients {
+			c.deliverLogs(m.logs)
+		}
+		m.RUnlock()
 	}
 }
 
-func (b *logBuffer) append(line string, max int) {
-	if line == "" {
-		return
-	}
+func newLogBuffer(max int) *logBuffer {
+	return &logBuffer{max: max}
+}
+
+func (b *logBuffer) append(e mclog.Entry) {
 	b.Lock()
-	b.buf = append(b.buf, line)
+	b.buf = append(b.buf, e)
 	b.total++
-	if overflow := len(b.buf) - max; overflow > 0 {
+	if overflow := len(b.buf) - b.max; overflow > 0 {
 		b.buf = b.buf[overflow:]
 	}
 	b.Unlock()
 }
 
-func (b *logBuffer) pending(since int) (out []string, newTotal int) {
+// Tells whether every entry from pos on is still buffered
+func (b *logBuffer) has(pos int) bool {
+	b.Lock()
+	defer b.Unlock()
+	return pos >= b.total-len(b.buf) && pos <= b.total
+}
+
+// Position the next entry will get
+func (b *logBuffer) end() int {
+	b.Lock()
+	defer b.Unlock()
+	return b.total
+}
+
+/*
+Returns the entries from position pos on and the position after the last
+one. missed counts entries after pos that are no longer buffered.
+*/
+func (b *logBuffer) since(pos int) (entries []LogEntry, next int, missed int) {
 	b.Lock()
 	defer b.Unlock()
 
-	if since >= b.total {
-		return nil, b.total
+	first := b.total - len(b.buf)
+	if pos < first {
+		missed, pos = first-pos, first
+	}
+	for i := pos - first; i < len(b.buf); i++ {
+		entries = append(entries, LogEntry{Position: first + i, Entry: b.buf[i]})
+	}
+	return entries, b.total, missed
+}
+
+/*
+Returns up to n entries accepted by keep that come before position pos,
+oldest first, and whether older matching entries may still be buffered.
+*/
+func (b *logBuffer) before(pos, n int, keep func(mclog.Entry) bool) ([]LogEntry, bool) {
+	b.Lock()
+	defer b.Unlock()
+
+	first := b.total - len(b.buf)
+	if pos > b.total {
+		pos = b.total
+	}
+
+	entries := []LogEntry{}
+	i := pos - first - 1
+	for ; i >= 0 && len(entries) < n; i-- {
+		if keep(b.buf[i]) {
+			entries = append(entries, LogEntry{Position: first + i, Entry: b.buf[i]})
+		}
 	}
-	start := len(b.buf) - (b.total - since)
-	return b.buf[start:], b.total
+	slices.Reverse(entries)
+	return entries, i >= 0
 }
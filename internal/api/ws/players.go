@@ -0,0 +1,58 @@
+package ws
+
+import (
+	"encoding/json"
+	"log/slog"
+
+	"github.com/vnxcius/mcpanel-back/internal/players"
+)
+
+/*
+Passes a log line to the player tracker and broadcasts the join or leave
+it describes, and the new player count. Addresses are never broadcast,
+only stored.
+*/
+func (m *WSManager) trackPlayers(line string) {
+	evt, ok := m.tracker.HandleLine(line)
+	if !ok {
+		return
+	}
+
+	eventType := EventPlayerJoined
+	if evt.Type == players.Left {
+		eventType = EventPlayerLeft
+	}
+
+	evt.IP = ""
+	payload, err := json.Marshal(evt)
+	if err != nil {
+		slog.Error("Error marshalling player event", "error", err)
+		return
+	}
+
+	m.publish(TopicPlayers, Event{Type: eventType, Payload: payload}, nil)
+	m.broadcastPlayerCount()
+}
+
+// PlayerCountEvent is all public clients learn about who is playing
+type PlayerCountEvent struct {
+	Online int `json:"online"`
+}
+
+func (m *WSManager) playerCount() PlayerCountEvent {
+	return PlayerCountEvent{Online: len(m.tracker.Online())}
+}
+
+func (m *WSManager) broadcastPlayerCount() {
+	payload, err := json.Marshal(m.playerCount())
+	if err != nil {
+		slog.Error("Error marshalling player count", "error", err)
+		return
+	}
+	m.publish(TopicPlayers, Event{Type: EventPlayerCount, Payload: payload}, nil)
+}
+
+// Returns the players currently connected to the Minecraft server
+func (m *WSManager) OnlinePlayers() []players.Player {
+	return m.tracker.Online()
+}
@@ -0,0 +1,115 @@
+package ws
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// published events kept for clients resuming a session
+	replaySize = 1000
+	// a bigger gap is sent as a snapshot instead, it wouldn't fit the
+	// client's queue anyway
+	maxReplay = 400
+)
+
+// A published event with what's needed to decide who gets it again
+type replayEntry struct {
+	topic  Topic
+	tier   Tier
+	event  Event
+	public Event
+}
+
+/*
+Ring of the latest published events. Every published event gets the next
+sequence number so clients can tell what they missed. Numbers start from
+the startup time, so a seq from before a restart is always behind the ring
+and gets a snapshot, while staying below 2^53 for JavaScript clients.
+*/
+type replayRing struct {
+	sync.Mutex
+	entries []replayEntry
+	start   int
+	seq     uint64
+}
+
+func newReplayRing() *replayRing {
+	return &replayRing{
+		entries: make([]replayEntry, 0, replaySize),
+		seq:     uint64(time.Now().UnixMilli()) * 1000,
+	}
+}
+
+// Numbers the entry's events and keeps it
+func (r *replayRing) add(e *replayEntry) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.seq++
+	e.event.Seq = r.seq
+	e.public.Seq = r.seq
+
+	if len(r.entries) < replaySize {
+		r.entries = append(r.entries, *e)
+		return
+	}
+	r.entries[r.start] = *e
+	r.start = (r.start + 1) % replaySize
+}
+
+// Sequence number of the latest published event
+func (r *replayRing) last() uint64 {
+	r.Lock()
+	defer r.Unlock()
+	return r.seq
+}
+
+/*
+Returns the events published after seq, oldest first. ok is false if some
+of them are no longer kept or seq is ahead of the ring.
+*/
+func (r *replayRing) since(seq uint64) (entries []replayEntry, ok bool) {
+	r.Lock()
+	defer r.Unlock()
+
+	if seq > r.seq {
+		return nil, false
+	}
+	missed := int(r.seq - seq)
+	if missed > len(r.entries) {
+		return nil, false
+	}
+
+	for i := len(r.entries) - missed; i < len(r.entries); i++ {
+		entries = append(entries, r.entries[(r.start+i)%len(r.entries)])
+	}
+	return entries, true
+}
+
+/*
+Returns the events the client missed since seq, those of its topics and
+tier. ok is false when they can't all be replayed and the client needs a
+snapshot instead.
+*/
+func (c *Client) missedEvents(seq uint64) (events []Event, ok bool) {
+	entries, ok := c.manager.replay.since(seq)
+	if !ok {
+		return nil, false
+	}
+
+	for _, e := range entries {
+		if c.Tier() < e.tier || !c.subscribed(e.topic) {
+			continue
+		}
+		if c.Tier() < TierAuthenticated {
+			events = append(events, e.public)
+		} else {
+			events = append(events, e.event)
+		}
+	}
+	if len(events) > maxReplay {
+		return nil, false
+	}
+	return events, true
+}
@@ -0,0 +1,246 @@
+package ws
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/vnxcius/mcpanel-back/internal/logging"
+	"github.com/vnxcius/mcpanel-back/internal/mclog"
+	"github.com/vnxcius/mcpanel-back/internal/players"
+)
+
+// A hub without the Minecraft server, the database or connections
+func newTestManager() *WSManager {
+	m := &WSManager{
+		clients:       ClientList{},
+		handlers:      map[string]EventHandler{},
+		currentStatus: "offline",
+		tracker:       players.NewTracker(false),
+		logs:          newLogBuffer(100),
+		topics:        newTopicCounters(),
+		replay:        newReplayRing(),
+	}
+	m.setupEventHandlers()
+	return m
+}
+
+// Drains the events queued for a client
+func received(c *Client) []Event {
+	var events []Event
+	for {
+		select {
+		case evt := <-c.egress:
+			events = append(events, evt)
+		default:
+			return events
+		}
+	}
+}
+
+func eventTypes(events []Event) []string {
+	types := []string{}
+	for _, evt := range events {
+		types = append(types, evt.Type)
+	}
+	return types
+}
+
+func TestReplayRingSince(t *testing.T) {
+	r := newReplayRing()
+	first := r.last() + 1
+	for range replaySize + 10 {
+		r.add(&replayEntry{topic: TopicStatus, event: Event{Type: EventStatusUpdate}})
+	}
+	last := r.last()
+	// the ring wrapped, the first ten events are gone
+	oldest := first + 10
+
+	tests := []struct {
+		name  string
+		seq   uint64
+		count int
+		ok    bool
+	}{
+		{"up to date", last, 0, true},
+		{"inside the ring", last - 5, 5, true},
+		{"oldest kept", oldest - 1, replaySize, true},
+		{"before the ring", oldest - 2, 0, false},
+		{"from before a restart", 1, 0, false},
+		{"after the ring", last + 1, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, ok := r.since(tt.seq)
+			if ok != tt.ok || len(entries) != tt.count {
+				t.Fatalf("since(%d) = %d entries, %v, want %d, %v", tt.seq, len(entries), ok, tt.count, tt.ok)
+			}
+			for i, e := range entries {
+				if want := tt.seq + uint64(i) + 1; e.event.Seq != want {
+					t.Fatalf("entry %d has seq %d, want %d", i, e.event.Seq, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRegisterResumes(t *testing.T) {
+	m := newTestManager()
+	topics := []Topic{TopicStatus, TopicPlayers, TopicAlerts}
+	change, _ := json.Marshal(logging.ModChangeEntry{Name: "ae2.jar", Actor: &logging.Actor{Name: "admin"}})
+
+	start := m.replay.last()
+	m.SetStatus("starting")
+	m.publish(TopicMods, Event{Type: EventModAdded, Payload: change}, nil)
+	m.Publish(TopicAlerts, EventAlert, json.RawMessage(`{}`))
+	m.SetStatus("online")
+	last := m.replay.last()
+
+	tests := []struct {
+		name    string
+		actor   *logging.Actor
+		since   uint64
+		resumed bool
+		want    []string
+	}{
+		{
+			name:    "inside the ring",
+			since:   start + 1,
+			resumed: true,
+			// the mods and alerts topics are not the client's
+			want: []string{EventSession, EventSubscriptions, EventStatusUpdate},
+		},
+		{
+			name:    "inside the ring, authenticated",
+			actor:   &logging.Actor{Kind: logging.ActorSession, Name: "admin"},
+			since:   start,
+			resumed: true,
+			want:    []string{EventSession, EventSubscriptions, EventStatusUpdate, EventAlert, EventStatusUpdate},
+		},
+		{
+			name:    "up to date",
+			since:   last,
+			resumed: true,
+			want:    []string{EventSession, EventSubscriptions},
+		},
+		{
+			name:    "before the ring",
+			since:   1,
+			resumed: false,
+			want:    []string{EventSession, EventSubscriptions, EventStatusUpdate, EventPlayerCount},
+		},
+		{
+			name:    "after the ring",
+			since:   last + 100,
+			resumed: false,
+			want:    []string{EventSession, EventSubscriptions, EventStatusUpdate, EventPlayerCount},
+		},
+		{
+			name:    "new client",
+			resumed: false,
+			want:    []string{EventSession, EventSubscriptions, EventStatusUpdate, EventPlayerCount},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewClient(nil, m, "127.0.0.1")
+			seq, _ := m.register(c, ClientOptions{Actor: tt.actor, Topics: topics, Since: tt.since})
+			defer m.RemoveClient(c)
+
+			events := received(c)
+			if got := eventTypes(events); !slices.Equal(got, tt.want) {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+
+			var session SessionEvent
+			if err := json.Unmarshal(events[0].Payload, &session); err != nil {
+				t.Fatal(err)
+			}
+			if session.Resumed != tt.resumed || session.Seq != last || seq != last {
+				t.Fatalf("got session %+v and seq %d, want resumed %v at %d", session, seq, tt.resumed, last)
+			}
+
+			if !tt.resumed {
+				return
+			}
+			// replayed events keep their numbers, in order
+			prev := tt.since
+			for _, evt := range events[2:] {
+				if evt.Seq <= prev || evt.Seq > last {
+					t.Fatalf("replayed %s with seq %d after %d", evt.Type, evt.Seq, prev)
+				}
+				prev = evt.Seq
+			}
+		})
+	}
+}
+
+func TestRegisterConsolePosition(t *testing.T) {
+	m := newTestManager()
+	for range 10 {
+		m.logs.append(mclog.Entry{Level: "INFO", Raw: "[12:00:00] [Server thread/INFO]: tick"})
+	}
+	start := m.replay.last()
+	m.SetStatus("online")
+	actor := &logging.Actor{Kind: logging.ActorSession, Name: "admin"}
+
+	tests := []struct {
+		name     string
+		since    uint64
+		position int
+		cursor   int
+	}{
+		{"resumed", start, 4, 4},
+		{"resumed with a position that is gone", start, 200, 10},
+		{"not resumed", 1, 4, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewClient(nil, m, "127.0.0.1")
+			_, cursor := m.register(c, ClientOptions{Actor: actor, Topics: []Topic{TopicStatus}, Since: tt.since, Position: tt.position})
+			defer m.RemoveClient(c)
+
+			if cursor != tt.cursor {
+				t.Fatalf("console starts at %d, want %d", cursor, tt.cursor)
+			}
+		})
+	}
+}
+
+func TestMissedEventsAreRedactedForPublicClients(t *testing.T) {
+	m := newTestManager()
+	start := m.replay.last()
+
+	actor := &logging.Actor{Kind: logging.ActorSession, Name: "admin"}
+	m.UpdateModlist(EventModAdded, logging.ModChangeEntry{Type: logging.ModAdded, Name: "ae2.jar", Actor: actor, IP: "10.0.0.1"})
+
+	tests := []struct {
+		name      string
+		actor     *logging.Actor
+		wantActor bool
+	}{
+		{"public", nil, false},
+		{"authenticated", actor, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewClient(nil, m, "127.0.0.1")
+			c.actor = tt.actor
+			c.subscribe([]Topic{TopicMods})
+
+			events, ok := c.missedEvents(start)
+			if !ok || len(events) != 1 {
+				t.Fatalf("got %d events, %v", len(events), ok)
+			}
+
+			var change logging.ModChangeEntry
+			if err := json.Unmarshal(events[0].Payload, &change); err != nil {
+				t.Fatal(err)
+			}
+			if (change.Actor != nil) != tt.wantActor || change.IP != "" {
+				t.Fatalf("got change %+v", change)
+			}
+		})
+	}
+}
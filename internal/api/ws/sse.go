@@ -0,0 +1,101 @@
+package ws
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// how often an idle event stream gets a comment so proxies keep it open
+const streamKeepAlive = 15 * time.Second
+
+/*
+Parses a Last-Event-ID sent by a reconnecting event stream, "<seq>.<pos>"
+with pos the next log position. Either part may be missing.
+*/
+func ParseLastEventID(id string) (seq uint64, pos int, err error) {
+	seqPart, posPart, _ := strings.Cut(id, ".")
+	if seqPart != "" {
+		if seq, err = strconv.ParseUint(seqPart, 10, 64); err != nil {
+			return 0, 0, fmt.Errorf("invalid event id %q", id)
+		}
+	}
+	if posPart != "" {
+		if pos, err = strconv.Atoi(posPart); err != nil || pos < 0 {
+			return 0, 0, fmt.Errorf("invalid event id %q", id)
+		}
+	}
+	return seq, pos, nil
+}
+
+/*
+Streams the hub's events to w as server-sent events until ctx is done. The
+stream gets the same events a websocket client with opts would, and can't
+send any. Every published event and log append carries an id to resume
+from, flush is called after each write.
+*/
+func (m *WSManager) Stream(ctx context.Context, w io.Writer, flush func(), opts ClientOptions) error {
+	c := NewClient(nil, m, opts.IP)
+	defer m.RemoveClient(c)
+
+	if _, err := io.WriteString(w, "retry: 3000\n\n"); err != nil {
+		return err
+	}
+	flush()
+	seq, pos := m.register(c, opts)
+	go m.syncWithMinecraft()
+
+	ticker := time.NewTicker(streamKeepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-c.done:
+			// removed by the hub, because it fell behind or its session
+			// ended; the browser reconnects and resumes if it can
+			slog.Info("Event stream closed by the server", "ip", c.ip)
+			return nil
+		case <-ticker.C:
+			if _, err := io.WriteString(w, ": ping\n\n"); err != nil {
+				return err
+			}
+		case evt := <-c.egress:
+			id := ""
+			// events reach the client in seq order, replayed ones first
+			if evt.Seq > 0 {
+				seq = evt.Seq
+			}
+			if evt.logNext > 0 {
+				pos = evt.logNext
+			}
+			if evt.Seq > 0 || evt.logNext > 0 {
+				id = fmt.Sprintf("%d.%d", seq, pos)
+			}
+			if err := writeStreamEvent(w, id, evt); err != nil {
+				return err
+			}
+		}
+		flush()
+	}
+}
+
+func writeStreamEvent(w io.Writer, id string, evt Event) error {
+	var b strings.Builder
+	if id != "" {
+		b.WriteString("id: " + id + "\n")
+	}
+	b.WriteString("event: " + evt.Type + "\n")
+	for _, line := range strings.Split(string(evt.Payload), "\n") {
+		b.WriteString("data: " + line + "\n")
+	}
+	b.WriteString("\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,277 @@
+package ws
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+/*
+Topic groups the events producers publish. Clients receive the events of
+the topics they are subscribed to, all of them unless they ask otherwise.
+*/
+type Topic string
+
+const (
+	TopicStatus    Topic = "status"
+	TopicConsole   Topic = "console"
+	TopicMods      Topic = "mods"
+	TopicChangelog Topic = "changelog"
+	TopicPlayers   Topic = "players"
+	TopicMetrics   Topic = "metrics"
+	TopicAlerts    Topic = "alerts"
+	TopicConfig    Topic = "config"
+)
+
+var Topics = []Topic{TopicStatus, TopicConsole, TopicMods, TopicChangelog, TopicPlayers, TopicMetrics, TopicAlerts, TopicConfig}
+
+// topics only authenticated clients may subscribe to
+var authenticatedTopics = []Topic{TopicConsole, TopicAlerts, TopicConfig}
+
+// events sent by clients
+const (
+	EventSubscribe   = "subscribe"
+	EventUnsubscribe = "unsubscribe"
+)
+
+// sent to clients
+const EventSubscriptions = "subscriptions"
+
+type SubscriptionRequest struct {
+	Topics []Topic `json:"topics"`
+}
+
+type SubscriptionsEvent struct {
+	Topics []Topic `json:"topics"`
+}
+
+// TopicStats counts what happened on a topic since startup
+type TopicStats struct {
+	Topic       Topic  `json:"topic"`
+	Subscribers int    `json:"subscribers"`
+	Published   uint64 `json:"published"`
+	Dropped     uint64 `json:"dropped"`
+}
+
+type topicCounters struct {
+	published atomic.Uint64
+	dropped   atomic.Uint64
+}
+
+// Set of topics a client is subscribed to
+type subscriptions struct {
+	sync.Mutex
+	topics map[Topic]bool
+}
+
+func newTopicCounters() map[Topic]*topicCounters {
+	counters := make(map[Topic]*topicCounters, len(Topics))
+	for _, t := range Topics {
+		counters[t] = &topicCounters{}
+	}
+	return counters
+}
+
+func (t Topic) tier() Tier {
+	if slices.Contains(authenticatedTopics, t) {
+		return TierAuthenticated
+	}
+	return TierPublic
+}
+
+/*
+Parses a comma separated list of topics, as given in ?topics= when
+connecting. An empty list means every topic.
+*/
+func ParseTopics(value string) ([]Topic, error) {
+	if value == "" {
+		return slices.Clone(Topics), nil
+	}
+
+	topics := []Topic{}
+	for _, name := range strings.Split(value, ",") {
+		t := Topic(strings.TrimSpace(name))
+		if !slices.Contains(Topics, t) {
+			return nil, errors.New("unknown topic " + string(t))
+		}
+		topics = append(topics, t)
+	}
+	return topics, nil
+}
+
+func (c *Client) subscribed(t Topic) bool {
+	c.subs.Lock()
+	defer c.subs.Unlock()
+	return c.subs.topics[t]
+}
+
+func (c *Client) setSubscribed(t Topic, on bool) {
+	c.subs.Lock()
+	defer c.subs.Unlock()
+	if on {
+		c.subs.topics[t] = true
+	} else {
+		delete(c.subs.topics, t)
+	}
+}
+
+func (c *Client) subscribedTopics() []Topic {
+	c.subs.Lock()
+	defer c.subs.Unlock()
+
+	topics := []Topic{}
+	for _, t := range Topics {
+		if c.subs.topics[t] {
+			topics = append(topics, t)
+		}
+	}
+	return topics
+}
+
+/*
+Subscribes the client to topics, skipping those its tier can't see.
+Subscribing to the console starts the stream at the newest entry.
+*/
+func (c *Client) subscribe(topics []Topic) {
+	for _, t := range topics {
+		if c.Tier() < t.tier() {
+			continue
+		}
+		if t == TopicConsole {
+			c.startConsole()
+			continue
+		}
+		c.setSubscribed(t, true)
+	}
+}
+
+func (c *Client) sendSubscriptions() {
+	payload, err := json.Marshal(SubscriptionsEvent{Topics: c.subscribedTopics()})
+	if err != nil {
+		slog.Error("Error marshalling subscriptions", "error", err)
+		return
+	}
+	c.send(Event{Type: EventSubscriptions, Payload: payload})
+}
+
+func parseSubscriptionRequest(event Event) ([]Topic, error) {
+	var req SubscriptionRequest
+	if err := json.Unmarshal(event.Payload, &req); err != nil {
+		return nil, err
+	}
+	for _, t := range req.Topics {
+		if !slices.Contains(Topics, t) {
+			return nil, invalidPayload("unknown topic " + string(t))
+		}
+	}
+	return req.Topics, nil
+}
+
+func subscribeHandler(event Event, c *Client) (any, error) {
+	topics, err := parseSubscriptionRequest(event)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range topics {
+		if c.Tier() < t.tier() {
+			return nil, &Error{Code: CodeUnauthenticated, Err: errors.New("topic " + string(t) + " requires authentication")}
+		}
+	}
+
+	c.subscribe(topics)
+	c.sendSubscriptions()
+	return nil, nil
+}
+
+func unsubscribeHandler(event Event, c *Client) (any, error) {
+	topics, err := parseSubscriptionRequest(event)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, t := range topics {
+		c.setSubscribed(t, false)
+	}
+	c.sendSubscriptions()
+	return nil, nil
+}
+
+/*
+Numbers an event and sends it to the clients subscribed to topic that may
+see it. Public clients get the redacted payload instead, if one is given.
+*/
+func (m *WSManager) publish(topic Topic, evt Event, redacted json.RawMessage) {
+	tier := max(eventTier(evt.Type), topic.tier())
+	evt.frames = newFrames()
+	public := evt
+	if redacted != nil {
+		public.Payload = redacted
+		public.frames = newFrames()
+	}
+
+	counters := m.topics[topic]
+	counters.published.Add(1)
+
+	// numbering and sending together keeps each client's events in order
+	m.publishing.Lock()
+	defer m.publishing.Unlock()
+
+	entry := replayEntry{topic: topic, tier: tier, event: evt, public: public}
+	m.replay.add(&entry)
+	evt, public = entry.event, entry.public
+
+	m.RLock()
+	defer m.RUnlock()
+
+	for c := range m.clients {
+		if c.Tier() < tier || !c.subscribed(topic) {
+			continue
+		}
+
+		out := evt
+		if c.Tier() < TierAuthenticated {
+			out = public
+		}
+
+		select {
+		case c.egress <- out:
+			slog.Debug("Publishing event", "topic", topic, "type", evt.Type)
+		default:
+			// a gap in its events would go unnoticed, reconnecting replays them
+			counters.dropped.Add(1)
+			slog.Warn("client buffer full, disconnecting client", "topic", topic, "ip", c.ip)
+			go m.RemoveClient(c)
+		}
+	}
+}
+
+// Sends an event to the clients subscribed to topic
+func (m *WSManager) Publish(topic Topic, eventType string, payload json.RawMessage) {
+	m.publish(topic, Event{Type: eventType, Payload: payload}, nil)
+}
+
+func (m *WSManager) TopicStats() []TopicStats {
+	subscribers := map[Topic]int{}
+	m.RLock()
+	for c := range m.clients {
+		for _, t := range c.subscribedTopics() {
+			subscribers[t]++
+		}
+	}
+	m.RUnlock()
+
+	stats := []TopicStats{}
+	for _, t := range Topics {
+		stats = append(stats, TopicStats{
+			Topic:       t,
+			Subscribers: subscribers[t],
+			Published:   m.topics[t].published.Load(),
+			Dropped:     m.topics[t].dropped.Load(),
+		})
+	}
+	return stats
+}
@@ -0,0 +1,65 @@
+package ws
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/vnxcius/mcpanel-back/internal/logging"
+)
+
+func TestSubscribe(t *testing.T) {
+	m := &WSManager{clients: ClientList{}, topics: newTopicCounters()}
+	actor := &logging.Actor{Kind: logging.ActorSession, Name: "admin"}
+
+	tests := []struct {
+		name   string
+		actor  *logging.Actor
+		topics []Topic
+		err    bool
+	}{
+		{"public topics", nil, []Topic{TopicStatus, TopicMods, TopicPlayers}, false},
+		{"metrics", nil, []Topic{TopicMetrics}, false},
+		{"metrics when authenticated", actor, []Topic{TopicMetrics}, false},
+		{"authenticated topic", nil, []Topic{TopicAlerts}, true},
+		{"authenticated topic when authenticated", actor, []Topic{TopicAlerts, TopicConfig}, false},
+		{"unknown topic", actor, []Topic{"weather"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewClient(nil, m, "127.0.0.1")
+			c.actor = tt.actor
+
+			payload, _ := json.Marshal(SubscriptionRequest{Topics: tt.topics})
+			_, err := subscribeHandler(Event{Type: EventSubscribe, Payload: payload}, c)
+			if (err != nil) != tt.err {
+				t.Fatalf("got error %v, want error %v", err, tt.err)
+			}
+			if tt.err {
+				return
+			}
+
+			if got := c.subscribedTopics(); !slices.Equal(got, tt.topics) {
+				t.Fatalf("subscribed to %q, want %q", got, tt.topics)
+			}
+			if evt := <-c.egress; evt.Type != EventSubscriptions {
+				t.Fatalf("got %s, want the subscriptions", evt.Type)
+			}
+		})
+	}
+}
+
+func TestParseTopics(t *testing.T) {
+	all, err := ParseTopics("")
+	if err != nil || !slices.Equal(all, Topics) || !slices.Contains(all, TopicMetrics) {
+		t.Fatalf("got %q, %v", all, err)
+	}
+
+	if got, err := ParseTopics("status, metrics"); err != nil || !slices.Equal(got, []Topic{TopicStatus, TopicMetrics}) {
+		t.Fatalf("got %q, %v", got, err)
+	}
+	if _, err := ParseTopics("status,weather"); err == nil {
+		t.Fatal("unknown topic accepted")
+	}
+}
@@ -0,0 +1,554 @@
+package backup
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vnxcius/mcpanel-back/internal/properties"
+	"github.com/vnxcius/mcpanel-back/internal/rcon"
+)
+
+type Backup struct {
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type Stage string
+
+const (
+	StageStarted   Stage = "started"
+	StageArchiving Stage = "archiving"
+	StageFinished  Stage = "finished"
+	StageFailed    Stage = "failed"
+	StageRestoring Stage = "restoring"
+	StageRestored  Stage = "restored"
+	StageDeleted   Stage = "deleted"
+)
+
+type Progress struct {
+	Name       string `json:"name"`
+	Stage      Stage  `json:"stage"`
+	Files      int    `json:"files"`
+	TotalFiles int    `json:"totalFiles"`
+	Bytes      int64  `json:"bytes"`
+	Error      string `json:"error,omitempty"`
+}
+
+type Options struct {
+	ServerDir string
+	Dir       string
+	Retention Retention
+
+	// Status returns the current server status ("online", "offline", ...)
+	Status func() string
+	// OnProgress is called as backups and restores advance
+	OnProgress func(Progress)
+}
+
+/*
+Manager creates, lists and restores world backups. Only one backup or
+restore runs at a time.
+*/
+type Manager struct {
+	mu   sync.Mutex
+	busy bool
+	opts Options
+
+	// replaced by tests
+	command func(string) (string, error)
+	rename  func(oldpath, newpath string) error
+}
+
+var (
+	ErrBusy          = errors.New("a backup or restore is already running")
+	ErrNotFound      = errors.New("backup not found")
+	ErrInvalidName   = errors.New("invalid backup name")
+	ErrServerRunning = errors.New("the server must be offline to restore a backup")
+
+	Backups *Manager
+)
+
+const (
+	namePrefix = "backup-"
+	nameLayout = "2006-01-02T15-04-05"
+	extension  = ".zip"
+)
+
+// files and folders besides the world that are worth keeping
+var extraPaths = []string{
+	"server.properties",
+	"config",
+	"defaultconfigs",
+	"whitelist.json",
+	"ops.json",
+	"banned-players.json",
+	"banned-ips.json",
+}
+
+func InitializeManager(opts Options) {
+	if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+		slog.Error("Failed to create backup directory", "dir", opts.Dir, "error", err)
+	}
+	Backups = newManager(opts)
+}
+
+func newManager(opts Options) *Manager {
+	return &Manager{
+		opts:    opts,
+		command: rcon.Command,
+		rename:  os.Rename,
+	}
+}
+
+/*
+Returns the existing backups, newest first.
+*/
+func (m *Manager) List() ([]Backup, error) {
+	entries, err := os.ReadDir(m.opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	backups := []Backup{}
+	for _, e := range entries {
+		created, ok := parseName(e.Name())
+		if e.IsDir() || !ok {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		backups = append(backups, Backup{
+			Name:      e.Name(),
+			Size:      info.Size(),
+			CreatedAt: created,
+		})
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].CreatedAt.After(backups[j].CreatedAt)
+	})
+
+	return backups, nil
+}
+
+/*
+Returns the absolute path of a backup archive, validating its name.
+*/
+func (m *Manager) Path(name string) (string, error) {
+	if _, ok := parseName(name); !ok || name != filepath.Base(name) {
+		return "", ErrInvalidName
+	}
+
+	path := filepath.Join(m.opts.Dir, name)
+	if _, err := os.Stat(path); err != nil {
+		return "", ErrNotFound
+	}
+	return path, nil
+}
+
+func (m *Manager) Delete(name string) error {
+	path, err := m.Path(name)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+
+	m.report(Progress{Name: name, Stage: StageDeleted})
+	return nil
+}
+
+/*
+Reports whether a backup or restore is in progress.
+*/
+func (m *Manager) Busy() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.busy
+}
+
+/*
+Starts a backup in the background and returns its name. Progress is
+reported through Options.OnProgress.
+*/
+func (m *Manager) Start() (string, error) {
+	if !m.acquire() {
+		return "", ErrBusy
+	}
+
+	name := namePrefix + time.Now().Format(nameLayout) + extension
+	go func() {
+		defer m.release()
+		if err := m.create(name); err != nil {
+			slog.Error("Backup failed", "name", name, "error", err)
+			m.report(Progress{Name: name, Stage: StageFailed, Error: err.Error()})
+			return
+		}
+		m.prune()
+	}()
+
+	return name, nil
+}
+
+/*
+Restores a backup over the server directory. Refuses to run unless the
+server is offline.
+*/
+func (m *Manager) Restore(name string) error {
+	path, err := m.Path(name)
+	if err != nil {
+		return err
+	}
+
+	if !m.acquire() {
+		return ErrBusy
+	}
+	// checked while holding the job, the server only leaves offline
+	// through WhileIdle
+	if m.opts.Status() != "offline" {
+		m.release()
+		return ErrServerRunning
+	}
+
+	go func() {
+		defer m.release()
+		m.report(Progress{Name: name, Stage: StageRestoring})
+		if err := m.restore(path); err != nil {
+			slog.Error("Restore failed", "name", name, "error", err)
+			m.report(Progress{Name: name, Stage: StageFailed, Error: err.Error()})
+			return
+		}
+		slog.Info("Backup restored", "name", name)
+		m.report(Progress{Name: name, Stage: StageRestored})
+	}()
+
+	return nil
+}
+
+func (m *Manager) create(name string) error {
+	m.report(Progress{Name: name, Stage: StageStarted})
+
+	if m.opts.Status() != "offline" {
+		// stop autosave and flush the world so the files on disk are consistent
+		if _, err := m.command("save-off"); err != nil {
+			return fmt.Errorf("disabling autosave: %w", err)
+		}
+		defer func() {
+			if _, err := m.command("save-on"); err != nil {
+				slog.Error("Failed to re-enable autosave after backup", "error", err)
+			}
+		}()
+
+		if _, err := m.command("save-all flush"); err != nil {
+			return fmt.Errorf("flushing world: %w", err)
+		}
+	}
+
+	paths := append([]string{m.worldName()}, extraPaths...)
+	files, err := m.collect(paths)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := filepath.Join(m.opts.Dir, name+".tmp")
+	out, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+
+	zw := zip.NewWriter(out)
+	progress := Progress{Name: name, Stage: StageArchiving, TotalFiles: len(files)}
+	lastReport := time.Now()
+
+	for _, rel := range files {
+		n, err := m.addFile(zw, rel)
+		if err != nil {
+			zw.Close()
+			out.Close()
+			return fmt.Errorf("adding %s: %w", rel, err)
+		}
+
+		progress.Files++
+		progress.Bytes += n
+		if time.Since(lastReport) > time.Second {
+			m.report(progress)
+			lastReport = time.Now()
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpPath, filepath.Join(m.opts.Dir, name)); err != nil {
+		return err
+	}
+
+	progress.Stage = StageFinished
+	m.report(progress)
+	slog.Info("Backup created", "name", name, "files", progress.Files, "bytes", progress.Bytes)
+	return nil
+}
+
+/*
+Returns every regular file under paths, relative to the server directory.
+*/
+func (m *Manager) collect(paths []string) ([]string, error) {
+	var files []string
+	for _, p := range paths {
+		root := filepath.Join(m.opts.ServerDir, p)
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					return nil
+				}
+				return err
+			}
+			// session.lock is held open by the server
+			if !d.Type().IsRegular() || d.Name() == "session.lock" {
+				return nil
+			}
+			rel, err := filepath.Rel(m.opts.ServerDir, path)
+			if err != nil {
+				return err
+			}
+			files = append(files, rel)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+func (m *Manager) addFile(zw *zip.Writer, rel string) (int64, error) {
+	f, err := os.Open(filepath.Join(m.opts.ServerDir, rel))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return 0, err
+	}
+	header.Name = filepath.ToSlash(rel)
+	header.Method = zip.Deflate
+
+	w, err := zw.CreateHeader(header)
+	if err != nil {
+		return 0, err
+	}
+	return io.Copy(w, f)
+}
+
+/*
+Extracts the archive into a staging folder, then swaps each top level entry
+into the server directory. The replaced files are only removed once every
+entry has been moved in place; if a swap fails they are moved back.
+*/
+func (m *Manager) restore(path string) error {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	staging := filepath.Join(m.opts.ServerDir, ".restore-staging")
+	previous := filepath.Join(m.opts.ServerDir, ".restore-previous")
+
+	// a failed rollback leaves the original files here, never delete them
+	if entries, err := os.ReadDir(previous); err == nil && len(entries) > 0 {
+		return fmt.Errorf("%s holds files from an interrupted restore, move them back first", previous)
+	}
+	_ = os.RemoveAll(staging)
+	_ = os.RemoveAll(previous)
+	defer os.RemoveAll(staging)
+
+	topLevel := map[string]bool{}
+	for _, f := range zr.File {
+		name := filepath.FromSlash(f.Name)
+		if !filepath.IsLocal(name) {
+			return fmt.Errorf("unsafe path in archive: %s", f.Name)
+		}
+		topLevel[strings.Split(name, string(filepath.Separator))[0]] = true
+
+		if err := extractFile(f, filepath.Join(staging, name)); err != nil {
+			return err
+		}
+	}
+
+	if err := os.MkdirAll(previous, 0o755); err != nil {
+		return err
+	}
+
+	var swapped []swap
+	for entry := range topLevel {
+		s := swap{entry: entry}
+		current := filepath.Join(m.opts.ServerDir, entry)
+		if _, err := os.Lstat(current); err == nil {
+			if err := m.rename(current, filepath.Join(previous, entry)); err != nil {
+				return m.rollback(swapped, err)
+			}
+			s.replaced = true
+		}
+		swapped = append(swapped, s)
+
+		if err := m.rename(filepath.Join(staging, entry), current); err != nil {
+			return m.rollback(swapped, err)
+		}
+		swapped[len(swapped)-1].restored = true
+	}
+
+	return os.RemoveAll(previous)
+}
+
+// A top level entry of a restore and how far its swap got
+type swap struct {
+	entry    string
+	replaced bool
+	restored bool
+}
+
+/*
+Undoes the swaps of a failed restore, newest first, putting the original
+files back. Anything that can't be moved back stays in .restore-previous.
+*/
+func (m *Manager) rollback(swapped []swap, cause error) error {
+	previous := filepath.Join(m.opts.ServerDir, ".restore-previous")
+
+	var failed []error
+	for i := len(swapped) - 1; i >= 0; i-- {
+		s := swapped[i]
+		current := filepath.Join(m.opts.ServerDir, s.entry)
+		if s.restored {
+			if err := os.RemoveAll(current); err != nil {
+				failed = append(failed, err)
+				continue
+			}
+		}
+		if s.replaced {
+			if err := os.Rename(filepath.Join(previous, s.entry), current); err != nil {
+				failed = append(failed, err)
+			}
+		}
+	}
+
+	if len(failed) > 0 {
+		slog.Error("Failed to roll back restore, original files are kept", "dir", previous, "errors", errors.Join(failed...))
+		return fmt.Errorf("restore failed and could not be rolled back, original files are in %s: %w", previous, cause)
+	}
+	_ = os.Remove(previous)
+	return fmt.Errorf("restore failed and was rolled back: %w", cause)
+}
+
+func extractFile(f *zip.File, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	if f.FileInfo().IsDir() {
+		return os.MkdirAll(dst, 0o755)
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, f.Mode().Perm()|0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, rc); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func (m *Manager) worldName() string {
+	data, err := os.ReadFile(filepath.Join(m.opts.ServerDir, "server.properties"))
+	if err == nil {
+		if props, err := properties.Parse(data); err == nil {
+			if name, ok := props.Get("level-name"); ok && filepath.IsLocal(name) {
+				return name
+			}
+		}
+	}
+	return "world"
+}
+
+/*
+Runs fn unless a backup or restore is in progress, keeping new ones from
+starting until it returns. fn must be quick.
+*/
+func (m *Manager) WhileIdle(fn func()) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.busy {
+		return ErrBusy
+	}
+	fn()
+	return nil
+}
+
+func (m *Manager) acquire() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.busy {
+		return false
+	}
+	m.busy = true
+	return true
+}
+
+func (m *Manager) release() {
+	m.mu.Lock()
+	m.busy = false
+	m.mu.Unlock()
+}
+
+func (m *Manager) report(p Progress) {
+	if m.opts.OnProgress != nil {
+		m.opts.OnProgress(p)
+	}
+}
+
+func parseName(name string) (time.Time, bool) {
+	if !strings.HasPrefix(name, namePrefix) || !strings.HasSuffix(name, extension) {
+		return time.Time{}, false
+	}
+	stamp := strings.TrimSuffix(strings.TrimPrefix(name, namePrefix), extension)
+	t, err := time.ParseInLocation(nameLayout, stamp, time.Local)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
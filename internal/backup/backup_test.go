@@ -0,0 +1,365 @@
+package backup
+
+import (
+	"archive/zip"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A stand-in for the server's RCON, recording the commands sent to it
+type fakeRcon struct {
+	mu       sync.Mutex
+	commands []string
+	fail     map[string]error
+}
+
+func (r *fakeRcon) command(command string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.commands = append(r.commands, command)
+	return "", r.fail[command]
+}
+
+func (r *fakeRcon) sent() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.commands)
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+/*
+Builds a manager over a server directory holding a world and a config,
+with a fake RCON and the given server status.
+*/
+func newTestManager(t *testing.T, status string) (*Manager, *fakeRcon) {
+	t.Helper()
+	base := t.TempDir()
+	serverDir := filepath.Join(base, "server")
+	writeFiles(t, serverDir, map[string]string{
+		"server.properties":   "level-name=survival\n",
+		"survival/level.dat":  "level",
+		"survival/region/r.0": "region",
+		"config/mod.toml":     "enabled = true\n",
+	})
+
+	backupDir := filepath.Join(base, "backups")
+	if err := os.MkdirAll(backupDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	rcon := &fakeRcon{fail: map[string]error{}}
+	m := newManager(Options{
+		ServerDir: serverDir,
+		Dir:       backupDir,
+		Status:    func() string { return status },
+	})
+	m.command = rcon.command
+	return m, rcon
+}
+
+func TestCreateBracketsWithSaves(t *testing.T) {
+	m, rcon := newTestManager(t, "online")
+
+	name := "backup-2024-06-01T12-00-00.zip"
+	if err := m.create(name); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"save-off", "save-all flush", "save-on"}
+	if got := rcon.sent(); !slices.Equal(got, want) {
+		t.Fatalf("sent %q, want %q", got, want)
+	}
+
+	zr, err := zip.OpenReader(filepath.Join(m.opts.Dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+
+	var files []string
+	for _, f := range zr.File {
+		files = append(files, f.Name)
+	}
+	slices.Sort(files)
+	wantFiles := []string{"config/mod.toml", "server.properties", "survival/level.dat", "survival/region/r.0"}
+	if !slices.Equal(files, wantFiles) {
+		t.Fatalf("archived %q, want %q", files, wantFiles)
+	}
+}
+
+func TestCreateReenablesSavesOnError(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(m *Manager, rcon *fakeRcon)
+		want  []string
+	}{
+		{
+			name: "flush fails",
+			setup: func(m *Manager, rcon *fakeRcon) {
+				rcon.fail["save-all flush"] = errors.New("timed out")
+			},
+			want: []string{"save-off", "save-all flush", "save-on"},
+		},
+		{
+			name: "archive fails",
+			setup: func(m *Manager, rcon *fakeRcon) {
+				m.opts.Dir = filepath.Join(m.opts.Dir, "missing")
+			},
+			want: []string{"save-off", "save-all flush", "save-on"},
+		},
+		{
+			name: "save-off fails",
+			setup: func(m *Manager, rcon *fakeRcon) {
+				rcon.fail["save-off"] = errors.New("connection refused")
+			},
+			// autosave was never disabled
+			want: []string{"save-off"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, rcon := newTestManager(t, "online")
+			tt.setup(m, rcon)
+
+			if err := m.create("backup-2024-06-01T12-00-00.zip"); err == nil {
+				t.Fatal("create succeeded")
+			}
+			if got := rcon.sent(); !slices.Equal(got, tt.want) {
+				t.Fatalf("sent %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateOfflineSkipsRcon(t *testing.T) {
+	m, rcon := newTestManager(t, "offline")
+
+	if err := m.create("backup-2024-06-01T12-00-00.zip"); err != nil {
+		t.Fatal(err)
+	}
+	if got := rcon.sent(); len(got) != 0 {
+		t.Fatalf("sent %q to an offline server", got)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	m, _ := newTestManager(t, "offline")
+	name := "backup-2024-06-01T12-00-00.zip"
+	if err := m.create(name); err != nil {
+		t.Fatal(err)
+	}
+
+	serverDir := m.opts.ServerDir
+	writeFiles(t, serverDir, map[string]string{
+		"survival/level.dat":  "changed",
+		"survival/region/r.1": "new region",
+		"config/mod.toml":     "enabled = false\n",
+	})
+
+	if err := m.restore(filepath.Join(m.opts.Dir, name)); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := readFile(t, filepath.Join(serverDir, "survival", "level.dat")); got != "level" {
+		t.Errorf("level.dat is %q", got)
+	}
+	if got := readFile(t, filepath.Join(serverDir, "config", "mod.toml")); got != "enabled = true\n" {
+		t.Errorf("mod.toml is %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(serverDir, "survival", "region", "r.1")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("region added after the backup survived the restore: %v", err)
+	}
+	for _, dir := range []string{".restore-staging", ".restore-previous"} {
+		if _, err := os.Stat(filepath.Join(serverDir, dir)); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s left behind: %v", dir, err)
+		}
+	}
+}
+
+func TestRestoreRollsBackOnFailure(t *testing.T) {
+	m, _ := newTestManager(t, "offline")
+	name := "backup-2024-06-01T12-00-00.zip"
+	if err := m.create(name); err != nil {
+		t.Fatal(err)
+	}
+
+	serverDir := m.opts.ServerDir
+	writeFiles(t, serverDir, map[string]string{
+		"survival/level.dat": "changed",
+		"config/mod.toml":    "enabled = false\n",
+		"server.properties":  "level-name=survival\nmotd=changed\n",
+	})
+
+	// the second entry moved in from staging fails, after the first one
+	// already replaced the live files
+	staging := filepath.Join(serverDir, ".restore-staging")
+	fromStaging := 0
+	m.rename = func(oldpath, newpath string) error {
+		if filepath.Dir(oldpath) == staging {
+			fromStaging++
+			if fromStaging == 2 {
+				return errors.New("disk full")
+			}
+		}
+		return os.Rename(oldpath, newpath)
+	}
+
+	err := m.restore(filepath.Join(m.opts.Dir, name))
+	if err == nil || !strings.Contains(err.Error(), "rolled back") || !strings.Contains(err.Error(), "disk full") {
+		t.Fatalf("got %v, want a rolled back restore", err)
+	}
+
+	want := map[string]string{
+		"survival/level.dat": "changed",
+		"config/mod.toml":    "enabled = false\n",
+		"server.properties":  "level-name=survival\nmotd=changed\n",
+	}
+	for rel, content := range want {
+		if got := readFile(t, filepath.Join(serverDir, filepath.FromSlash(rel))); got != content {
+			t.Errorf("%s is %q after the rollback, want %q", rel, got, content)
+		}
+	}
+	for _, dir := range []string{".restore-staging", ".restore-previous"} {
+		if _, err := os.Stat(filepath.Join(serverDir, dir)); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s left behind: %v", dir, err)
+		}
+	}
+}
+
+func TestRestoreRefusesLeftoverPrevious(t *testing.T) {
+	m, _ := newTestManager(t, "offline")
+	name := "backup-2024-06-01T12-00-00.zip"
+	if err := m.create(name); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, m.opts.ServerDir, map[string]string{".restore-previous/survival/level.dat": "original"})
+
+	if err := m.restore(filepath.Join(m.opts.Dir, name)); err == nil || !strings.Contains(err.Error(), "interrupted restore") {
+		t.Fatalf("got %v, want a refused restore", err)
+	}
+	if got := readFile(t, filepath.Join(m.opts.ServerDir, ".restore-previous", "survival", "level.dat")); got != "original" {
+		t.Fatalf("leftover file is %q", got)
+	}
+}
+
+func backupAt(t time.Time) Backup {
+	return Backup{Name: namePrefix + t.Format(nameLayout) + extension, CreatedAt: t}
+}
+
+func TestRetentionExpired(t *testing.T) {
+	// a Wednesday, so the days below stay in one ISO week
+	now := time.Date(2024, 6, 5, 12, 30, 0, 0, time.Local)
+	at := func(d time.Duration) Backup { return backupAt(now.Add(-d)) }
+
+	backups := []Backup{
+		at(0),
+		at(10 * time.Minute),
+		at(time.Hour),
+		at(2 * time.Hour),
+		at(24 * time.Hour),
+		at(48 * time.Hour),
+		at(7 * 24 * time.Hour),
+		at(14 * 24 * time.Hour),
+	}
+
+	names := func(bs ...Backup) []string {
+		out := []string{}
+		for _, b := range bs {
+			out = append(out, b.Name)
+		}
+		return out
+	}
+
+	tests := []struct {
+		name      string
+		retention Retention
+		expired   []Backup
+	}{
+		{
+			name:      "hourly",
+			retention: Retention{Hourly: 2},
+			expired:   []Backup{backups[1], backups[3], backups[4], backups[5], backups[6], backups[7]},
+		},
+		{
+			name:      "hourly and daily",
+			retention: Retention{Hourly: 2, Daily: 3},
+			expired:   []Backup{backups[1], backups[3], backups[6], backups[7]},
+		},
+		{
+			name:      "weekly",
+			retention: Retention{Weekly: 2},
+			expired:   []Backup{backups[1], backups[2], backups[3], backups[4], backups[5], backups[7]},
+		},
+		{
+			name:      "more slots than backups",
+			retention: Retention{Hourly: 100},
+			expired:   []Backup{backups[1]},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := names(tt.retention.Expired(backups)...)
+			if want := names(tt.expired...); !slices.Equal(got, want) {
+				t.Fatalf("expired %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestPrune(t *testing.T) {
+	m, _ := newTestManager(t, "offline")
+	m.opts.Retention = Retention{Daily: 2}
+
+	now := time.Date(2024, 6, 5, 12, 0, 0, 0, time.Local)
+	var all []string
+	for _, d := range []time.Duration{0, time.Hour, 24 * time.Hour, 48 * time.Hour} {
+		name := backupAt(now.Add(-d)).Name
+		all = append(all, name)
+		writeFiles(t, m.opts.Dir, map[string]string{name: "zip"})
+	}
+	// files that aren't backups are never pruned
+	writeFiles(t, m.opts.Dir, map[string]string{"notes.txt": "keep"})
+
+	m.prune()
+
+	entries, err := os.ReadDir(m.opts.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var left []string
+	for _, e := range entries {
+		left = append(left, e.Name())
+	}
+	want := []string{all[2], all[0], "notes.txt"}
+	if !slices.Equal(left, want) {
+		t.Fatalf("left %q, want %q", left, want)
+	}
+}
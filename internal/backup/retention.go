@@ -0,0 +1,111 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+/*
+Retention keeps the newest backup of each of the last Hourly hours, Daily
+days and Weekly weeks. A backup kept by any of the rules survives.
+*/
+type Retention struct {
+	Hourly int
+	Daily  int
+	Weekly int
+}
+
+/*
+Returns the backups that fall outside the retention policy. backups must be
+sorted newest first.
+*/
+func (r Retention) Expired(backups []Backup) []Backup {
+	keep := make(map[string]bool, len(backups))
+
+	rules := []struct {
+		count  int
+		bucket func(time.Time) string
+	}{
+		{r.Hourly, func(t time.Time) string { return t.Format("2006-01-02T15") }},
+		{r.Daily, func(t time.Time) string { return t.Format("2006-01-02") }},
+		{r.Weekly, func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		}},
+	}
+
+	for _, rule := range rules {
+		seen := map[string]bool{}
+		for _, b := range backups {
+			if len(seen) >= rule.count {
+				break
+			}
+			bucket := rule.bucket(b.CreatedAt)
+			if seen[bucket] {
+				continue
+			}
+			seen[bucket] = true
+			keep[b.Name] = true
+		}
+	}
+
+	expired := []Backup{}
+	for _, b := range backups {
+		if !keep[b.Name] {
+			expired = append(expired, b)
+		}
+	}
+	return expired
+}
+
+/*
+Deletes backups outside the retention policy. A policy with every count at
+zero keeps everything.
+*/
+func (m *Manager) prune() {
+	r := m.opts.Retention
+	if r.Hourly == 0 && r.Daily == 0 && r.Weekly == 0 {
+		return
+	}
+
+	backups, err := m.List()
+	if err != nil {
+		slog.Error("Failed to list backups for pruning", "error", err)
+		return
+	}
+
+	for _, b := range r.Expired(backups) {
+		if err := os.Remove(filepath.Join(m.opts.Dir, b.Name)); err != nil {
+			slog.Error("Failed to prune backup", "name", b.Name, "error", err)
+			continue
+		}
+		slog.Info("Pruned backup", "name", b.Name)
+	}
+}
+
+/*
+Takes a backup every interval while the server is online, until ctx is
+cancelled.
+*/
+func (m *Manager) Schedule(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if m.opts.Status() != "online" {
+				continue
+			}
+			if _, err := m.Start(); err != nil {
+				slog.Warn("Skipping scheduled backup", "error", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,324 @@
+package configs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/vnxcius/mcpanel-back/internal/properties"
+	"github.com/vnxcius/mcpanel-back/internal/utils"
+)
+
+type File struct {
+	Path    string `json:"path"`
+	Format  string `json:"format"`
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"modTime"`
+}
+
+type Content struct {
+	Path        string `json:"path"`
+	Format      string `json:"format"`
+	Content     string `json:"content"`
+	Hash        string `json:"hash"`
+	HasPrevious bool   `json:"hasPrevious"`
+}
+
+/*
+Store gives sandboxed access to the config directories of a server.
+Every path it accepts is relative to the server directory and must resolve
+inside one of the config roots, even after following symlinks.
+*/
+type Store struct {
+	mu         sync.Mutex
+	serverDir  string
+	historyDir string
+}
+
+var (
+	ErrInvalidPath  = errors.New("invalid path")
+	ErrNotFound     = errors.New("config file not found")
+	ErrUnsupported  = errors.New("unsupported config format")
+	ErrHashMismatch = errors.New("config file was changed since it was read")
+	ErrNoPrevious   = errors.New("no previous version to restore")
+)
+
+const maxConfigSize = 4 << 20 // 4 MB
+
+func NewStore(serverDir, historyDir string) *Store {
+	return &Store{serverDir: serverDir, historyDir: historyDir}
+}
+
+/*
+Returns the config roots relative to the server directory. The world
+serverconfig folder follows the level-name in server.properties.
+*/
+func (s *Store) Roots() []string {
+	world := "world"
+	data, err := os.ReadFile(filepath.Join(s.serverDir, "server.properties"))
+	if err == nil {
+		if props, err := properties.Parse(data); err == nil {
+			if name, ok := props.Get("level-name"); ok && name != "" {
+				world = name
+			}
+		}
+	}
+
+	return []string{"config", "defaultconfigs", filepath.ToSlash(filepath.Join(world, "serverconfig"))}
+}
+
+/*
+Lists every supported config file under the config roots.
+*/
+func (s *Store) List() ([]File, error) {
+	files := []File{}
+
+	for _, root := range s.Roots() {
+		rootPath := filepath.Join(s.serverDir, filepath.FromSlash(root))
+		err := filepath.WalkDir(rootPath, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					return nil
+				}
+				return err
+			}
+			if d.IsDir() || FormatOf(path) == "" {
+				return nil
+			}
+
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+
+			rel, err := filepath.Rel(s.serverDir, path)
+			if err != nil {
+				return nil
+			}
+
+			// hide symlinks that point outside the sandbox
+			if _, err := s.resolve(filepath.ToSlash(rel)); err != nil {
+				return nil
+			}
+
+			files = append(files, File{
+				Path:    filepath.ToSlash(rel),
+				Format:  FormatOf(path),
+				Size:    info.Size(),
+				ModTime: info.ModTime().Unix(),
+			})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+
+	return files, nil
+}
+
+/*
+Reads a config file along with the hash clients must send back when saving.
+*/
+func (s *Store) Read(rel string) (Content, error) {
+	path, err := s.resolve(rel)
+	if err != nil {
+		return Content{}, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return Content{}, ErrNotFound
+		}
+		return Content{}, err
+	}
+
+	return s.content(rel, path, data), nil
+}
+
+/*
+Validates and saves a config file. expectedHash must match the current
+contents, otherwise ErrHashMismatch is returned and nothing is written.
+The replaced contents are kept so the change can be undone.
+Returns the new contents and the hash of the replaced version.
+*/
+func (s *Store) Write(rel string, data []byte, expectedHash string) (Content, string, error) {
+	path, err := s.resolve(rel)
+	if err != nil {
+		return Content{}, "", err
+	}
+
+	if len(data) > maxConfigSize {
+		return Content{}, "", fmt.Errorf("config file larger than %d bytes", maxConfigSize)
+	}
+
+	if err := Validate(path, data); err != nil {
+		return Content{}, "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return Content{}, "", ErrNotFound
+		}
+		return Content{}, "", err
+	}
+
+	oldHash := Hash(current)
+	if oldHash != expectedHash {
+		return Content{}, "", ErrHashMismatch
+	}
+
+	if err := s.savePrevious(rel, current); err != nil {
+		return Content{}, "", fmt.Errorf("saving previous version: %w", err)
+	}
+
+	if err := utils.WriteFileAtomic(path, data); err != nil {
+		return Content{}, "", err
+	}
+
+	return s.content(rel, path, data), oldHash, nil
+}
+
+/*
+Swaps a config file with its previous version, so undoing twice redoes the
+change. expectedHash guards against reverting over someone else's edit.
+Returns the restored contents and the hash of the replaced version.
+*/
+func (s *Store) Undo(rel string, expectedHash string) (Content, string, error) {
+	path, err := s.resolve(rel)
+	if err != nil {
+		return Content{}, "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, err := os.ReadFile(s.previousPath(rel))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return Content{}, "", ErrNoPrevious
+		}
+		return Content{}, "", err
+	}
+
+	current, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return Content{}, "", ErrNotFound
+		}
+		return Content{}, "", err
+	}
+
+	oldHash := Hash(current)
+	if oldHash != expectedHash {
+		return Content{}, "", ErrHashMismatch
+	}
+
+	if err := s.savePrevious(rel, current); err != nil {
+		return Content{}, "", fmt.Errorf("saving previous version: %w", err)
+	}
+
+	if err := utils.WriteFileAtomic(path, previous); err != nil {
+		return Content{}, "", err
+	}
+
+	return s.content(rel, path, previous), oldHash, nil
+}
+
+func Hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *Store) content(rel, path string, data []byte) Content {
+	_, err := os.Stat(s.previousPath(rel))
+	return Content{
+		Path:        filepath.ToSlash(filepath.Clean(rel)),
+		Format:      FormatOf(path),
+		Content:     string(data),
+		Hash:        Hash(data),
+		HasPrevious: err == nil,
+	}
+}
+
+/*
+Turns a client supplied relative path into an absolute one, rejecting
+anything outside the config roots or with an unsupported extension.
+*/
+func (s *Store) resolve(rel string) (string, error) {
+	if rel == "" || filepath.IsAbs(rel) || strings.Contains(rel, `\`) {
+		return "", ErrInvalidPath
+	}
+
+	clean := filepath.Clean(filepath.FromSlash(rel))
+	if clean == "." || strings.HasPrefix(clean, "..") {
+		return "", ErrInvalidPath
+	}
+
+	if FormatOf(clean) == "" {
+		return "", ErrUnsupported
+	}
+
+	serverDir, err := filepath.EvalSymlinks(s.serverDir)
+	if err != nil {
+		return "", err
+	}
+
+	for _, root := range s.Roots() {
+		rootPath := filepath.Join(serverDir, filepath.FromSlash(root))
+		path := filepath.Join(serverDir, clean)
+		if !isWithin(rootPath, path) {
+			continue
+		}
+
+		// follow symlinks so a link inside config/ can't point elsewhere
+		resolved, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return "", ErrNotFound
+			}
+			return "", err
+		}
+		resolvedRoot, err := filepath.EvalSymlinks(rootPath)
+		if err != nil || !isWithin(resolvedRoot, resolved) {
+			return "", ErrInvalidPath
+		}
+
+		return resolved, nil
+	}
+
+	return "", ErrInvalidPath
+}
+
+func isWithin(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != "." && !strings.HasPrefix(rel, "..")
+}
+
+func (s *Store) previousPath(rel string) string {
+	return filepath.Join(s.historyDir, filepath.Clean(filepath.FromSlash(rel))+".prev")
+}
+
+func (s *Store) savePrevious(rel string, data []byte) error {
+	path := s.previousPath(rel)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
@@ -0,0 +1,231 @@
+package configs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+/*
+Builds a server directory with a file in each config root, a file outside
+them and a history directory next to it.
+*/
+func newTestStore(t *testing.T) (*Store, string) {
+	t.Helper()
+	base := t.TempDir()
+	serverDir := filepath.Join(base, "server")
+
+	files := map[string]string{
+		"server.properties":                "level-name=survival\n",
+		"config/mod.toml":                  "enabled = true\n",
+		"config/nested/other.json":         `{"a": 1}`,
+		"defaultconfigs/default.toml":      "x = 1\n",
+		"survival/serverconfig/world.toml": "y = 2\n",
+		"world/serverconfig/stale.toml":    "z = 3\n",
+		"secret.json":                      `{"token": "hunter2"}`,
+	}
+	for name, content := range files {
+		path := filepath.Join(serverDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return NewStore(serverDir, filepath.Join(base, "history")), serverDir
+}
+
+func symlink(t *testing.T, target, link string) {
+	t.Helper()
+	if err := os.Symlink(target, link); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	s, serverDir := newTestStore(t)
+	outside := filepath.Join(filepath.Dir(serverDir), "outside.toml")
+	if err := os.WriteFile(outside, []byte("a = 1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	symlink(t, outside, filepath.Join(serverDir, "config", "escape.toml"))
+	symlink(t, filepath.Join(serverDir, "secret.json"), filepath.Join(serverDir, "config", "secret.json"))
+	symlink(t, filepath.Dir(serverDir), filepath.Join(serverDir, "config", "up"))
+	symlink(t, filepath.Join(serverDir, "config", "mod.toml"), filepath.Join(serverDir, "config", "alias.toml"))
+
+	tests := []struct {
+		name string
+		path string
+		err  error
+	}{
+		{"config file", "config/mod.toml", nil},
+		{"nested file", "config/nested/other.json", nil},
+		{"defaultconfigs", "defaultconfigs/default.toml", nil},
+		{"serverconfig of level-name", "survival/serverconfig/world.toml", nil},
+		{"unclean path inside a root", "config/nested/../mod.toml", nil},
+		{"symlink inside the root", "config/alias.toml", nil},
+
+		{"empty", "", ErrInvalidPath},
+		{"root itself", "config", ErrUnsupported},
+		{"parent directory", "../outside.toml", ErrInvalidPath},
+		{"dot dot through a root", "config/../secret.json", ErrInvalidPath},
+		{"dot dot out of the server", "config/../../outside.toml", ErrInvalidPath},
+		{"absolute path", filepath.Join(serverDir, "config", "mod.toml"), ErrInvalidPath},
+		{"backslashes", `config\mod.toml`, ErrInvalidPath},
+		{"outside the roots", "secret.json", ErrInvalidPath},
+		{"serverconfig of another world", "world/serverconfig/stale.toml", ErrInvalidPath},
+		{"unsupported extension", "config/mod.jar", ErrUnsupported},
+		{"missing file", "config/missing.toml", ErrNotFound},
+		{"symlink out of the server", "config/escape.toml", ErrInvalidPath},
+		{"symlink to a file outside the roots", "config/secret.json", ErrInvalidPath},
+		{"symlinked directory out of the server", "config/up/outside.toml", ErrInvalidPath},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.resolve(tt.path)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("resolve(%q) = %v, want %v", tt.path, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestListHidesEscapingSymlinks(t *testing.T) {
+	s, serverDir := newTestStore(t)
+	symlink(t, filepath.Join(serverDir, "secret.json"), filepath.Join(serverDir, "config", "secret.json"))
+
+	files, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]bool{}
+	for _, f := range files {
+		got[f.Path] = true
+	}
+	for _, want := range []string{"config/mod.toml", "config/nested/other.json", "defaultconfigs/default.toml", "survival/serverconfig/world.toml"} {
+		if !got[want] {
+			t.Errorf("%s missing from %v", want, got)
+		}
+	}
+	for _, hidden := range []string{"config/secret.json", "secret.json", "world/serverconfig/stale.toml"} {
+		if got[hidden] {
+			t.Errorf("%s should not be listed", hidden)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	s, serverDir := newTestStore(t)
+	const rel = "config/mod.toml"
+	path := filepath.Join(serverDir, "config", "mod.toml")
+
+	current, err := s.Read(rel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current.HasPrevious {
+		t.Fatal("fresh file has a previous version")
+	}
+
+	tests := []struct {
+		name    string
+		data    string
+		hash    string
+		err     error
+		invalid bool
+	}{
+		{name: "stale hash", data: "enabled = false\n", hash: Hash([]byte("something else")), err: ErrHashMismatch},
+		{name: "empty hash", data: "enabled = false\n", hash: "", err: ErrHashMismatch},
+		{name: "invalid syntax", data: "enabled = = false\n", hash: current.Hash, invalid: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := s.Write(rel, []byte(tt.data), tt.hash)
+			var validationErr *ValidationError
+			if tt.invalid && !errors.As(err, &validationErr) {
+				t.Fatalf("got %v, want a validation error", err)
+			}
+			if !tt.invalid && !errors.Is(err, tt.err) {
+				t.Fatalf("got %v, want %v", err, tt.err)
+			}
+
+			data, _ := os.ReadFile(path)
+			if string(data) != "enabled = true\n" {
+				t.Fatalf("file changed to %q", data)
+			}
+		})
+	}
+
+	written, oldHash, err := s.Write(rel, []byte("enabled = false\n"), current.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if oldHash != current.Hash || written.Hash != Hash([]byte("enabled = false\n")) || !written.HasPrevious {
+		t.Fatalf("got %+v with old hash %s", written, oldHash)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "enabled = false\n" {
+		t.Fatalf("file is %q", data)
+	}
+
+	// the hash read before the write is stale now
+	if _, _, err := s.Write(rel, []byte("enabled = true\n"), current.Hash); !errors.Is(err, ErrHashMismatch) {
+		t.Fatalf("got %v, want %v", err, ErrHashMismatch)
+	}
+}
+
+func TestWriteRejectsPathsOutsideTheSandbox(t *testing.T) {
+	s, serverDir := newTestStore(t)
+
+	for _, rel := range []string{"secret.json", "config/../secret.json", "../outside.json"} {
+		if _, _, err := s.Write(rel, []byte(`{}`), Hash([]byte(`{"token": "hunter2"}`))); !errors.Is(err, ErrInvalidPath) {
+			t.Errorf("Write(%q) = %v, want %v", rel, err, ErrInvalidPath)
+		}
+	}
+	if data, _ := os.ReadFile(filepath.Join(serverDir, "secret.json")); string(data) != `{"token": "hunter2"}` {
+		t.Fatalf("secret.json changed to %q", data)
+	}
+}
+
+func TestUndo(t *testing.T) {
+	s, _ := newTestStore(t)
+	const rel = "config/mod.toml"
+
+	original, err := s.Read(rel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.Undo(rel, original.Hash); !errors.Is(err, ErrNoPrevious) {
+		t.Fatalf("undo without a previous version: got %v, want %v", err, ErrNoPrevious)
+	}
+
+	edited, _, err := s.Write(rel, []byte("enabled = false\n"), original.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := s.Undo(rel, original.Hash); !errors.Is(err, ErrHashMismatch) {
+		t.Fatalf("undo with a stale hash: got %v, want %v", err, ErrHashMismatch)
+	}
+
+	restored, oldHash, err := s.Undo(rel, edited.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.Content != original.Content || oldHash != edited.Hash {
+		t.Fatalf("undo restored %q replacing %s", restored.Content, oldHash)
+	}
+
+	// undoing again redoes the edit
+	redone, _, err := s.Undo(rel, restored.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if redone.Content != edited.Content {
+		t.Fatalf("redo restored %q", redone.Content)
+	}
+}
@@ -0,0 +1,90 @@
+package configs
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/titanous/json5"
+	"github.com/vnxcius/mcpanel-back/internal/properties"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	FormatTOML       = "toml"
+	FormatJSON       = "json"
+	FormatJSON5      = "json5"
+	FormatProperties = "properties"
+	FormatYAML       = "yaml"
+)
+
+/*
+ValidationError is returned when a config file fails to parse.
+*/
+type ValidationError struct {
+	Format string
+	Err    error
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid %s: %v", e.Format, e.Err)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+/*
+Returns the config format for a file name, or an empty string if the panel
+does not know how to validate it.
+*/
+func FormatOf(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".toml":
+		return FormatTOML
+	case ".json":
+		return FormatJSON
+	case ".json5":
+		return FormatJSON5
+	case ".properties":
+		return FormatProperties
+	case ".yaml", ".yml":
+		return FormatYAML
+	default:
+		return ""
+	}
+}
+
+/*
+Checks that data is syntactically valid for the format of name.
+*/
+func Validate(name string, data []byte) error {
+	format := FormatOf(name)
+
+	var err error
+	switch format {
+	case FormatTOML:
+		var v map[string]any
+		err = toml.Unmarshal(data, &v)
+	case FormatJSON:
+		var v any
+		err = json.Unmarshal(data, &v)
+	case FormatJSON5:
+		var v any
+		err = json5.Unmarshal(data, &v)
+	case FormatProperties:
+		_, err = properties.Parse(data)
+	case FormatYAML:
+		var v any
+		err = yaml.Unmarshal(data, &v)
+	default:
+		return ErrUnsupported
+	}
+
+	if err != nil {
+		return &ValidationError{Format: format, Err: err}
+	}
+	return nil
+}
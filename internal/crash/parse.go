@@ -0,0 +1,278 @@
+package crash
+
+import (
+	"bufio"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+type Kind string
+
+const (
+	// KindMinecraft is a report from the crash-reports folder
+	KindMinecraft Kind = "minecraft"
+	// KindJVM is an hs_err_pid*.log written when the JVM itself dies
+	KindJVM Kind = "jvm"
+)
+
+// Mod is a mod the crash points at
+type Mod struct {
+	ID      string `json:"id,omitempty"`
+	Name    string `json:"name,omitempty"`
+	File    string `json:"file,omitempty"`
+	Version string `json:"version,omitempty"`
+}
+
+type Report struct {
+	ID            int64     `json:"id"`
+	File          string    `json:"file"`
+	Kind          Kind      `json:"kind"`
+	Time          time.Time `json:"time"`
+	Description   string    `json:"description"`
+	Exception     string    `json:"exception"`
+	SuspectedMods []Mod     `json:"suspectedMods"`
+	Content       string    `json:"content,omitempty"`
+
+	// modification time of the file, hs_err logs reuse names across crashes
+	modified time.Time
+}
+
+var (
+	crashReportPattern = regexp.MustCompile(`^crash-(\d{4}-\d{2}-\d{2}_\d{2}\.\d{2}\.\d{2})-\w+\.txt$`)
+	jvmReportPattern   = regexp.MustCompile(`^hs_err_pid\d+\.log$`)
+
+	// ~[examplemod-1.0.jar%23123!/:?] or [examplemod-1.0.jar:?]
+	frameJarPattern = regexp.MustCompile(`\[([^\[\]/%!:]+\.jar)(?:%23\d+)?!?[/:]`)
+	// Example Mod (examplemod), Version: 1.0
+	suspectedPattern = regexp.MustCompile(`^(.+?) \(([\w.-]+)\), Version: (\S+)`)
+	// Time: 2024-06-22 14:03:11 or older 6/22/24 2:03 PM
+	crashTimeLayouts = []string{"2006-01-02 15:04:05", "2006-01-02 15:04:05.999", "1/2/06 3:04 PM"}
+)
+
+// jars that show up in every stack trace without being at fault
+var ignoredJars = []string{"minecraft", "server", "forge", "neoforge", "fmlloader", "fmlcore", "javafmllanguage",
+	"modlauncher", "bootstraplauncher", "securejarhandler", "mixin", "fabric-loader", "datafixerupper", "brigadier",
+	"authlib", "netty", "guava", "log4j"}
+
+/*
+Tells whether name is a report this package knows how to read.
+*/
+func IsReport(name string) (Kind, bool) {
+	switch {
+	case crashReportPattern.MatchString(name):
+		return KindMinecraft, true
+	case jvmReportPattern.MatchString(name):
+		return KindJVM, true
+	default:
+		return "", false
+	}
+}
+
+/*
+Parses a crash report. modified is used as the crash time when the report
+doesn't say.
+*/
+func Parse(name, content string, modified time.Time) Report {
+	kind, _ := IsReport(name)
+	r := Report{
+		File:          name,
+		Kind:          kind,
+		Time:          modified,
+		SuspectedMods: []Mod{},
+		Content:       content,
+		modified:      modified,
+	}
+
+	if kind == KindJVM {
+		parseJVM(&r, content)
+	} else {
+		parseMinecraft(&r, content)
+	}
+	return r
+}
+
+func parseMinecraft(r *Report, content string) {
+	if m := crashReportPattern.FindStringSubmatch(r.File); m != nil {
+		if t, err := time.ParseInLocation("2006-01-02_15.04.05", m[1], time.Local); err == nil {
+			r.Time = t
+		}
+	}
+
+	var (
+		jars      []string
+		mods      = map[string]Mod{}
+		suspected []Mod
+		inModList bool
+		inSuspect bool
+		afterDesc bool
+	)
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case strings.HasPrefix(line, "Time: "):
+			if t, ok := parseCrashTime(strings.TrimPrefix(line, "Time: ")); ok {
+				r.Time = t
+			}
+			continue
+		case strings.HasPrefix(line, "Description: ") && r.Description == "":
+			r.Description = strings.TrimPrefix(line, "Description: ")
+			afterDesc = true
+			continue
+		}
+
+		// the exception is the first line after the description
+		if afterDesc && r.Exception == "" && trimmed != "" {
+			r.Exception = trimmed
+			afterDesc = false
+		}
+
+		if strings.HasPrefix(trimmed, "at ") {
+			for _, m := range frameJarPattern.FindAllStringSubmatch(trimmed, -1) {
+				if !slices.Contains(jars, m[1]) {
+					jars = append(jars, m[1])
+				}
+			}
+		}
+
+		if strings.HasPrefix(trimmed, "Suspected Mod") {
+			inSuspect = true
+			rest := strings.TrimSpace(trimmed[strings.Index(trimmed, ":")+1:])
+			if m := suspectedPattern.FindStringSubmatch(rest); m != nil {
+				suspected = append(suspected, Mod{Name: m[1], ID: m[2], Version: m[3]})
+			}
+			continue
+		}
+		if inSuspect {
+			if m := suspectedPattern.FindStringSubmatch(trimmed); m != nil {
+				suspected = append(suspected, Mod{Name: m[1], ID: m[2], Version: m[3]})
+				continue
+			}
+			if strings.HasPrefix(trimmed, "Mod File: ") && len(suspected) > 0 {
+				suspected[len(suspected)-1].File = filepath.Base(strings.TrimPrefix(trimmed, "Mod File: "))
+				continue
+			}
+			if trimmed == "" || !strings.HasPrefix(line, "\t") {
+				inSuspect = false
+			}
+		}
+
+		if strings.HasPrefix(trimmed, "Mod List:") {
+			inModList = true
+			continue
+		}
+		if inModList {
+			mod, ok := parseModListLine(trimmed)
+			if !ok {
+				inModList = false
+				continue
+			}
+			mods[mod.File] = mod
+		}
+	}
+
+	if len(suspected) > 0 {
+		r.SuspectedMods = suspected
+		return
+	}
+
+	for _, jar := range jars {
+		if ignoredJar(jar) {
+			continue
+		}
+		mod, ok := mods[jar]
+		if !ok {
+			mod = Mod{File: jar}
+		}
+		r.SuspectedMods = append(r.SuspectedMods, mod)
+	}
+}
+
+/*
+Reads a row of the Forge mod list table:
+file.jar |Mod Name |modid |1.0 |DONE |Manifest: NOSIGNATURE
+*/
+func parseModListLine(line string) (Mod, bool) {
+	cols := strings.Split(line, "|")
+	if len(cols) < 4 || !strings.HasSuffix(strings.TrimSpace(cols[0]), ".jar") {
+		return Mod{}, false
+	}
+	return Mod{
+		File:    strings.TrimSpace(cols[0]),
+		Name:    strings.TrimSpace(cols[1]),
+		ID:      strings.TrimSpace(cols[2]),
+		Version: strings.TrimSpace(cols[3]),
+	}, true
+}
+
+func ignoredJar(jar string) bool {
+	if unescaped, err := url.PathUnescape(jar); err == nil {
+		jar = unescaped
+	}
+	name := strings.ToLower(strings.TrimSuffix(jar, ".jar"))
+	for _, ignored := range ignoredJars {
+		if name == ignored || strings.HasPrefix(name, ignored+"-") {
+			return true
+		}
+	}
+	return strings.HasPrefix(name, "java.")
+}
+
+func parseCrashTime(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	for _, layout := range crashTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+/*
+Reads the header of a JVM fatal error log:
+
+	# A fatal error has been detected by the Java Runtime Environment:
+	#
+	#  SIGSEGV (0xb) at pc=0x00007f, pid=1234, tid=5678
+	...
+	# Problematic frame:
+	# C  [libc.so.6+0x1234]
+*/
+func parseJVM(r *Report, content string) {
+	var nextIsFrame bool
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		text := strings.TrimSpace(strings.TrimPrefix(line, "#"))
+
+		switch {
+		case nextIsFrame:
+			r.Exception = text
+			nextIsFrame = false
+		case strings.HasPrefix(line, "#") && r.Description == "" && text != "" &&
+			!strings.HasPrefix(text, "A fatal error has been detected"):
+			r.Description = text
+		case text == "Problematic frame:":
+			nextIsFrame = true
+		case strings.HasPrefix(line, "Time: "):
+			// Time: Sat Jun 22 14:03:11 2024 UTC elapsed time: 12.3 seconds
+			value := strings.TrimPrefix(line, "Time: ")
+			if idx := strings.Index(value, " elapsed"); idx >= 0 {
+				value = value[:idx]
+			}
+			if t, err := time.Parse("Mon Jan _2 15:04:05 2006 MST", strings.TrimSpace(value)); err == nil {
+				r.Time = t
+			}
+		}
+	}
+}
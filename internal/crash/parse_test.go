@@ -0,0 +1,200 @@
+package crash
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+const forgeReport = `---- Minecraft Crash Report ----
+// Who set us up the TNT?
+
+Time: 2024-06-22 14:03:11
+Description: Ticking entity
+
+java.lang.NullPointerException: Cannot invoke "Object.hashCode()" because "key" is null
+	at java.util.HashMap.hash(HashMap.java:338) ~[?:?]
+	at com.example.broken.Thing.tick(Thing.java:42) ~[broken-1.2.jar%23187!/:1.2] {re:classloading}
+	at net.minecraft.world.entity.Entity.tick(Entity.java:100) ~[server-1.20.1-20230612.114412-srg.jar%23199!/:?]
+	at com.example.other.Hook.onTick(Hook.java:7) ~[other-mod-3.0.jar%23190!/:3.0]
+	at net.minecraftforge.fml.ModLoader.postEvent(ModLoader.java:302) ~[fmlcore-1.20.1-47.2.0.jar%23190!/:?]
+	at com.example.broken.Thing.tick(Thing.java:43) ~[broken-1.2.jar%23187!/:1.2]
+
+-- System Details --
+Details:
+	Mod List:
+		broken-1.2.jar                                    |Broken Mod                    |broken                        |1.2                 |DONE      |Manifest: NOSIGNATURE
+		other-mod-3.0.jar                                 |Other Mod                     |othermod                      |3.0                 |DONE      |Manifest: NOSIGNATURE
+	Crash Report UUID: 3f1c
+`
+
+const suspectedReport = `---- Minecraft Crash Report ----
+Time: 6/22/24 2:03 PM
+Description: Exception in server tick loop
+
+java.lang.IllegalStateException: Bad state
+	at com.example.broken.Thing.tick(Thing.java:42) ~[broken-1.2.jar%23187!/:1.2]
+
+-- Head --
+Stacktrace:
+	at com.example.broken.Thing.tick(Thing.java:42) ~[broken-1.2.jar%23187!/:1.2]
+Suspected Mods:
+	Broken Mod (broken), Version: 1.2
+		Issue tracker URL: https://example.com/issues
+		at TRANSFORMER/broken@1.2/com.example.broken.Thing.tick(Thing.java:42)
+	Mod File: /srv/minecraft/mods/broken-1.2.jar
+	Other Mod (othermod), Version: 3.0
+	Mod File: /srv/minecraft/mods/other-mod-3.0.jar
+Details:
+	Minecraft Version: 1.20.1
+`
+
+const jvmReport = `#
+# A fatal error has been detected by the Java Runtime Environment:
+#
+#  SIGSEGV (0xb) at pc=0x00007f3a1c2b4e10, pid=1234, tid=5678
+#
+# JRE version: OpenJDK Runtime Environment (17.0.8+7) (build 17.0.8+7)
+# Problematic frame:
+# C  [libc.so.6+0x15e10]
+#
+
+---------------  S U M M A R Y ------------
+
+Time: Sat Jun 22 14:03:11 2024 UTC elapsed time: 12.3 seconds (0d 0h 0m 12s)
+`
+
+func TestIsReport(t *testing.T) {
+	tests := []struct {
+		name string
+		kind Kind
+		ok   bool
+	}{
+		{"crash-2024-06-22_14.03.11-server.txt", KindMinecraft, true},
+		{"crash-2024-06-22_14.03.11-fml.txt", KindMinecraft, true},
+		{"hs_err_pid1234.log", KindJVM, true},
+		{"crash-2024-06-22-server.txt", "", false},
+		{"latest.log", "", false},
+		{"hs_err_pid.log", "", false},
+	}
+	for _, tt := range tests {
+		if kind, ok := IsReport(tt.name); kind != tt.kind || ok != tt.ok {
+			t.Errorf("IsReport(%q) = %q, %v, want %q, %v", tt.name, kind, ok, tt.kind, tt.ok)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	modified := time.Date(2024, 6, 23, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		file        string
+		content     string
+		time        time.Time
+		description string
+		exception   string
+		mods        []Mod
+	}{
+		{
+			name:        "mods from the stack trace",
+			file:        "crash-2024-06-22_14.03.11-server.txt",
+			content:     forgeReport,
+			time:        time.Date(2024, 6, 22, 14, 3, 11, 0, time.Local),
+			description: "Ticking entity",
+			exception:   `java.lang.NullPointerException: Cannot invoke "Object.hashCode()" because "key" is null`,
+			mods: []Mod{
+				{ID: "broken", Name: "Broken Mod", File: "broken-1.2.jar", Version: "1.2"},
+				{ID: "othermod", Name: "Other Mod", File: "other-mod-3.0.jar", Version: "3.0"},
+			},
+		},
+		{
+			name:        "suspected mods",
+			file:        "crash-2024-06-22_14.03.11-server.txt",
+			content:     suspectedReport,
+			time:        time.Date(2024, 6, 22, 14, 3, 0, 0, time.Local),
+			description: "Exception in server tick loop",
+			exception:   "java.lang.IllegalStateException: Bad state",
+			mods: []Mod{
+				{ID: "broken", Name: "Broken Mod", File: "broken-1.2.jar", Version: "1.2"},
+				{ID: "othermod", Name: "Other Mod", File: "other-mod-3.0.jar", Version: "3.0"},
+			},
+		},
+		{
+			name:        "time from the file name",
+			file:        "crash-2024-06-22_14.03.11-server.txt",
+			content:     "Description: Watching Server\n\njava.lang.Error: Watchdog\n",
+			time:        time.Date(2024, 6, 22, 14, 3, 11, 0, time.Local),
+			description: "Watching Server",
+			exception:   "java.lang.Error: Watchdog",
+			mods:        []Mod{},
+		},
+		{
+			name:    "unreadable report",
+			file:    "crash-2024-06-22_14.03.11-server.txt",
+			content: "",
+			time:    time.Date(2024, 6, 22, 14, 3, 11, 0, time.Local),
+			mods:    []Mod{},
+		},
+		{
+			name:        "jvm",
+			file:        "hs_err_pid1234.log",
+			content:     jvmReport,
+			time:        time.Date(2024, 6, 22, 14, 3, 11, 0, time.UTC),
+			description: "SIGSEGV (0xb) at pc=0x00007f3a1c2b4e10, pid=1234, tid=5678",
+			exception:   "C  [libc.so.6+0x15e10]",
+			mods:        []Mod{},
+		},
+		{
+			name:        "jvm without a time",
+			file:        "hs_err_pid1234.log",
+			content:     "# SIGABRT (0x6) at pc=0x0, pid=1, tid=2\n",
+			time:        modified,
+			description: "SIGABRT (0x6) at pc=0x0, pid=1, tid=2",
+			mods:        []Mod{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := Parse(tt.file, tt.content, modified)
+
+			if !r.Time.Equal(tt.time) {
+				t.Errorf("time %v, want %v", r.Time, tt.time)
+			}
+			if r.Description != tt.description {
+				t.Errorf("description %q, want %q", r.Description, tt.description)
+			}
+			if r.Exception != tt.exception {
+				t.Errorf("exception %q, want %q", r.Exception, tt.exception)
+			}
+			if !reflect.DeepEqual(r.SuspectedMods, tt.mods) {
+				t.Errorf("suspected mods %+v, want %+v", r.SuspectedMods, tt.mods)
+			}
+			if r.Content != tt.content || r.File != tt.file || !r.modified.Equal(modified) {
+				t.Errorf("got report %+v", r)
+			}
+		})
+	}
+}
+
+func TestIgnoredJar(t *testing.T) {
+	tests := []struct {
+		jar     string
+		ignored bool
+	}{
+		{"forge-47.2.0.jar", true},
+		{"server-1.20.1-20230612.114412-srg.jar", true},
+		{"fmlloader-1.20.1-47.2.0.jar", true},
+		{"java.base.jar", true},
+		{"Mixin.jar", true},
+		{"minecraft%2Dserver.jar", true},
+		{"forgery-1.0.jar", false},
+		{"create-1.20.1-0.5.1.jar", false},
+	}
+	for _, tt := range tests {
+		if got := ignoredJar(tt.jar); got != tt.ignored {
+			t.Errorf("ignoredJar(%q) = %v, want %v", tt.jar, got, tt.ignored)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package crash
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/vnxcius/mcpanel-back/internal/db"
+)
+
+var ErrNotFound = errors.New("crash report not found")
+
+type Page struct {
+	Reports    []Report `json:"reports"`
+	NextCursor int64    `json:"nextCursor,omitempty"`
+}
+
+const summaryColumns = `id, file, kind, crashed_at, description, exception, suspected_mods`
+
+/*
+Stores a report. The returned bool is false if the same file, by name and
+modification time, was already stored.
+*/
+func Save(r Report) (Report, bool, error) {
+	mods, err := json.Marshal(r.SuspectedMods)
+	if err != nil {
+		return r, false, err
+	}
+
+	err = db.DBConn.QueryRow(
+		`INSERT INTO "CrashReport"
+			(file, file_modified, kind, crashed_at, description, exception, suspected_mods, content)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (file, file_modified) DO NOTHING
+		RETURNING id`,
+		// Postgres text can't hold NUL bytes
+		r.File, storedTime(r.modified), string(r.Kind), r.Time, r.Description, r.Exception, string(mods),
+		strings.ReplaceAll(r.Content, "\x00", ""),
+	).Scan(&r.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return r, false, nil
+	}
+	if err != nil {
+		return r, false, err
+	}
+	return r, true, nil
+}
+
+// Tells whether file, as last modified at modified, was already stored
+func Exists(file string, modified time.Time) (bool, error) {
+	var exists bool
+	err := db.DBConn.QueryRow(
+		`SELECT EXISTS (SELECT 1 FROM "CrashReport" WHERE file = $1 AND file_modified = $2)`,
+		file, storedTime(modified),
+	).Scan(&exists)
+	return exists, err
+}
+
+// Postgres keeps microseconds, file times have nanoseconds
+func storedTime(t time.Time) time.Time {
+	return t.Truncate(time.Microsecond)
+}
+
+/*
+Returns a page of reports without their content, most recent crash first.
+cursor is the ID of the last report of the previous page.
+*/
+func List(cursor int64, limit int) (Page, error) {
+	query := `SELECT ` + summaryColumns + ` FROM "CrashReport"`
+	args := []any{limit + 1}
+	if cursor > 0 {
+		query += ` WHERE (crashed_at, id) < (SELECT crashed_at, id FROM "CrashReport" WHERE id = $2)`
+		args = append(args, cursor)
+	}
+	query += ` ORDER BY crashed_at DESC, id DESC LIMIT $1`
+
+	rows, err := db.DBConn.Query(query, args...)
+	if err != nil {
+		return Page{}, err
+	}
+	defer rows.Close()
+
+	reports := []Report{}
+	for rows.Next() {
+		r, err := scanReport(rows.Scan)
+		if err != nil {
+			return Page{}, err
+		}
+		reports = append(reports, r)
+	}
+	if err := rows.Err(); err != nil {
+		return Page{}, err
+	}
+
+	page := Page{Reports: reports}
+	if len(reports) > limit {
+		page.Reports = reports[:limit]
+		page.NextCursor = page.Reports[limit-1].ID
+	}
+	return page, nil
+}
+
+// Returns a report with its full content
+func Get(id int64) (Report, error) {
+	var content string
+	r, err := scanReport(func(dest ...any) error {
+		return db.DBConn.QueryRow(
+			`SELECT `+summaryColumns+`, content FROM "CrashReport" WHERE id = $1`, id,
+		).Scan(append(dest, &content)...)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return Report{}, ErrNotFound
+	}
+	if err != nil {
+		return Report{}, err
+	}
+
+	r.Content = content
+	return r, nil
+}
+
+func scanReport(scan func(dest ...any) error) (Report, error) {
+	var (
+		r    Report
+		kind string
+		t    time.Time
+		mods []byte
+	)
+	if err := scan(&r.ID, &r.File, &kind, &t, &r.Description, &r.Exception, &mods); err != nil {
+		return Report{}, err
+	}
+
+	r.Kind = Kind(kind)
+	r.Time = t.Local()
+	r.SuspectedMods = []Mod{}
+	_ = json.Unmarshal(mods, &r.SuspectedMods)
+	return r, nil
+}
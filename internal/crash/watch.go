@@ -0,0 +1,154 @@
+package crash
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	// reports are read once they stop growing for this long
+	settleDelay = 2 * time.Second
+	// larger reports are cut, hs_err logs can get big
+	maxReportSize = 8 << 20
+)
+
+type Options struct {
+	ServerDir string
+	// OnCrash is called with every new report, without its content
+	OnCrash func(Report)
+}
+
+/*
+Watches the server's crash-reports folder and the server folder itself,
+where the JVM writes hs_err_pid*.log, storing every new report. Reports
+already on disk at startup are stored without calling OnCrash. Blocks
+until ctx is done.
+*/
+func Watch(ctx context.Context, opts Options) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	crashDir := filepath.Join(opts.ServerDir, "crash-reports")
+	if err := watcher.Add(opts.ServerDir); err != nil {
+		return err
+	}
+	if err := watcher.Add(crashDir); err != nil && !os.IsNotExist(err) {
+		slog.Warn("Failed to watch crash reports", "dir", crashDir, "error", err)
+	}
+
+	ingestDir(opts.ServerDir, nil)
+	ingestDir(crashDir, nil)
+
+	ready := make(chan string)
+	timers := map[string]*time.Timer{}
+
+	for {
+		select {
+		case <-ctx.Done():
+			for _, t := range timers {
+				t.Stop()
+			}
+			return nil
+		case evt, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+
+			if evt.Name == crashDir && evt.Has(fsnotify.Create) {
+				if err := watcher.Add(crashDir); err != nil {
+					slog.Warn("Failed to watch crash reports", "dir", crashDir, "error", err)
+				}
+				ingestDir(crashDir, opts.OnCrash)
+				continue
+			}
+
+			if _, ok := IsReport(filepath.Base(evt.Name)); !ok || !evt.Has(fsnotify.Create|fsnotify.Write) {
+				continue
+			}
+
+			path := evt.Name
+			if t, ok := timers[path]; ok {
+				t.Reset(settleDelay)
+				continue
+			}
+			timers[path] = time.AfterFunc(settleDelay, func() {
+				select {
+				case ready <- path:
+				case <-ctx.Done():
+				}
+			})
+		case path := <-ready:
+			delete(timers, path)
+			ingest(path, opts.OnCrash)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			slog.Warn("Crash report watcher error", "error", err)
+		}
+	}
+}
+
+func ingestDir(dir string, onCrash func(Report)) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		if _, ok := IsReport(entry.Name()); !ok || !entry.Type().IsRegular() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if exists, err := Exists(entry.Name(), info.ModTime()); err != nil || exists {
+			continue
+		}
+		ingest(filepath.Join(dir, entry.Name()), onCrash)
+	}
+}
+
+func ingest(path string, onCrash func(Report)) {
+	f, err := os.Open(path)
+	if err != nil {
+		slog.Warn("Failed to open crash report", "path", path, "error", err)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(f, maxReportSize))
+	if err != nil {
+		slog.Warn("Failed to read crash report", "path", path, "error", err)
+		return
+	}
+
+	report, created, err := Save(Parse(filepath.Base(path), string(data), info.ModTime()))
+	if err != nil {
+		slog.Error("Failed to store crash report", "path", path, "error", err)
+		return
+	}
+	if !created {
+		return
+	}
+
+	slog.Warn("Minecraft server crashed", "report", report.File, "description", report.Description)
+	if onCrash != nil {
+		report.Content = ""
+		onCrash(report)
+	}
+}
@@ -0,0 +1,91 @@
+package db
+
+// statements are idempotent and run in order on every startup
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS "PlayerSession" (
+		id        BIGSERIAL PRIMARY KEY,
+		uuid      TEXT NOT NULL DEFAULT '',
+		name      TEXT NOT NULL,
+		ip        TEXT NOT NULL DEFAULT '',
+		joined_at TIMESTAMPTZ NOT NULL,
+		left_at   TIMESTAMPTZ
+	)`,
+	`CREATE INDEX IF NOT EXISTS "PlayerSession_name_idx" ON "PlayerSession" (lower(name))`,
+	`CREATE INDEX IF NOT EXISTS "PlayerSession_open_idx" ON "PlayerSession" (left_at) WHERE left_at IS NULL`,
+
+	`CREATE TABLE IF NOT EXISTS "ModChange" (
+		id            BIGSERIAL PRIMARY KEY,
+		changed_at    TIMESTAMPTZ NOT NULL,
+		type          TEXT NOT NULL,
+		name          TEXT NOT NULL,
+		actor_kind    TEXT,
+		actor_name    TEXT,
+		ip            TEXT NOT NULL DEFAULT '',
+		old_file      JSONB,
+		new_file      JSONB,
+		comment       TEXT NOT NULL DEFAULT '',
+		imported_from TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE INDEX IF NOT EXISTS "ModChange_time_idx" ON "ModChange" (changed_at)`,
+	`CREATE INDEX IF NOT EXISTS "ModChange_type_idx" ON "ModChange" (type, id)`,
+	`CREATE INDEX IF NOT EXISTS "ModChange_actor_idx" ON "ModChange" (lower(actor_name))`,
+	`CREATE TABLE IF NOT EXISTS "ModChangeImport" (
+		file        TEXT PRIMARY KEY,
+		entries     INTEGER NOT NULL,
+		imported_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`,
+
+	`CREATE TABLE IF NOT EXISTS "CrashReport" (
+		id             BIGSERIAL PRIMARY KEY,
+		file           TEXT NOT NULL,
+		file_modified  TIMESTAMPTZ NOT NULL,
+		kind           TEXT NOT NULL,
+		crashed_at     TIMESTAMPTZ NOT NULL,
+		description    TEXT NOT NULL DEFAULT '',
+		exception      TEXT NOT NULL DEFAULT '',
+		suspected_mods JSONB NOT NULL DEFAULT '[]',
+		content        TEXT NOT NULL,
+		created_at     TIMESTAMPTZ NOT NULL DEFAULT now(),
+		UNIQUE (file, file_modified)
+	)`,
+	`CREATE INDEX IF NOT EXISTS "CrashReport_time_idx" ON "CrashReport" (crashed_at, id)`,
+
+	`CREATE TABLE IF NOT EXISTS "AlertRule" (
+		id               BIGSERIAL PRIMARY KEY,
+		name             TEXT NOT NULL,
+		enabled          BOOLEAN NOT NULL DEFAULT true,
+		pattern          TEXT NOT NULL DEFAULT '',
+		levels           JSONB NOT NULL DEFAULT '[]',
+		logger           TEXT NOT NULL DEFAULT '',
+		threshold        INTEGER NOT NULL DEFAULT 1,
+		window_seconds   INTEGER NOT NULL DEFAULT 0,
+		cooldown_seconds INTEGER NOT NULL DEFAULT 300,
+		action           TEXT NOT NULL,
+		webhook_url      TEXT NOT NULL DEFAULT '',
+		created_at       TIMESTAMPTZ NOT NULL DEFAULT now(),
+		updated_at       TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`,
+	`CREATE TABLE IF NOT EXISTS "AlertFire" (
+		id        BIGSERIAL PRIMARY KEY,
+		rule_id   BIGINT NOT NULL REFERENCES "AlertRule" (id) ON DELETE CASCADE,
+		rule_name TEXT NOT NULL,
+		fired_at  TIMESTAMPTZ NOT NULL,
+		count     INTEGER NOT NULL,
+		sample    JSONB NOT NULL DEFAULT '[]',
+		delivered BOOLEAN NOT NULL DEFAULT false,
+		error     TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE INDEX IF NOT EXISTS "AlertFire_rule_idx" ON "AlertFire" (rule_id, id)`,
+}
+
+/*
+Creates the tables owned by the panel backend.
+*/
+func Migrate() error {
+	for _, m := range migrations {
+		if _, err := DBConn.Exec(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -2,32 +2,104 @@ package logging
 
 import (
 	"encoding/json"
-	"errors"
-	"io"
-	"log"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 )
 
-type ModChangelog struct {
+// dailyLog appends JSON lines to one file per day inside dir
+type dailyLog struct {
 	mu      sync.Mutex
 	current *os.File
 	date    string
 	dir     string
 }
 
+type ConfigChangelog struct {
+	dailyLog
+}
+
+type PlayerListChangelog struct {
+	dailyLog
+}
+
 type ModChangeType string
 
+type ActorKind string
+
+// Actor identifies who made a change
+type Actor struct {
+	Kind ActorKind `json:"kind"`
+	Name string    `json:"name"`
+}
+
+// ModFile describes one side of a mod change
+type ModFile struct {
+	Name    string `json:"name"`
+	Size    int64  `json:"size,omitempty"`
+	SHA256  string `json:"sha256,omitempty"`
+	Version string `json:"version,omitempty"`
+}
+
+/*
+ModChangeEntry is one line of the mod changelog. Name is the file the
+change is about: the new file for additions and updates, the removed one
+for deletions. Records written before actors and file details existed only
+have Time, Type and Name. ID is the row id in the ModChange table.
+*/
 type ModChangeEntry struct {
-	Time string        `json:"time"`
-	Type ModChangeType `json:"type"`
-	Name string        `json:"name"`
+	ID      int64         `json:"id,omitempty"`
+	Time    string        `json:"time"`
+	Type    ModChangeType `json:"type"`
+	Name    string        `json:"name"`
+	Actor   *Actor        `json:"actor,omitempty"`
+	IP      string        `json:"ip,omitempty"`
+	Old     *ModFile      `json:"old,omitempty"`
+	New     *ModFile      `json:"new,omitempty"`
+	Comment string        `json:"comment,omitempty"`
+}
+
+// Removes who made the change, for clients that don't get to see it
+func (e ModChangeEntry) Redacted() ModChangeEntry {
+	e.Actor = nil
+	e.IP = ""
+	return e
 }
 
-var modlog *ModChangelog
+type ConfigChangeType string
+
+type ConfigChangeEntry struct {
+	Time    string           `json:"time"`
+	Type    ConfigChangeType `json:"type"`
+	Path    string           `json:"path"`
+	OldHash string           `json:"oldHash"`
+	NewHash string           `json:"newHash"`
+	Actor   *Actor           `json:"actor,omitempty"`
+	IP      string           `json:"ip,omitempty"`
+}
+
+type PlayerListAction string
+
+type PlayerListChangeEntry struct {
+	Time    string           `json:"time"`
+	List    string           `json:"list"`
+	Action  PlayerListAction `json:"action"`
+	Player  string           `json:"player,omitempty"`
+	UUID    string           `json:"uuid,omitempty"`
+	Address string           `json:"address,omitempty"`
+	Reason  string           `json:"reason,omitempty"`
+	Via     string           `json:"via"`
+	Actor   *Actor           `json:"actor,omitempty"`
+	IP      string           `json:"ip,omitempty"`
+}
+
+var (
+	configlog     *ConfigChangelog
+	playerListlog *PlayerListChangelog
+)
 
 const (
 	ModAdded   ModChangeType = "added"
@@ -35,77 +107,93 @@ const (
 	ModUpdated ModChangeType = "updated"
 )
 
+const (
+	ActorSession  ActorKind = "session"
+	ActorBot      ActorKind = "bot"
+	ActorExternal ActorKind = "external"
+)
+
+const (
+	ConfigEdited   ConfigChangeType = "edited"
+	ConfigReverted ConfigChangeType = "reverted"
+)
+
+const (
+	PlayerListAdded   PlayerListAction = "added"
+	PlayerListRemoved PlayerListAction = "removed"
+)
+
 func (t ModChangeType) IsValid() bool {
 	return t == ModAdded || t == ModDeleted || t == ModUpdated
 }
 
-func SetupLogger(filePath string) {
-	logDir := filepath.Dir(filePath)
-	err := os.MkdirAll(logDir, 0755)
-	if err != nil {
-		panic("Failed to create log directory: " + err.Error())
-	}
+func (t ConfigChangeType) IsValid() bool {
+	return t == ConfigEdited || t == ConfigReverted
+}
 
-	err = os.Remove(filePath)
-	if err != nil && !errors.Is(err, os.ErrNotExist) {
-		slog.Error("Failed to remove old log file", "path", filePath, "error", err)
+/*
+Fills in Old and New for records written before they existed. Legacy
+updates stored both file names in Name as "old → new".
+*/
+func (e ModChangeEntry) Normalized() ModChangeEntry {
+	if e.Old != nil || e.New != nil {
+		return e
 	}
 
-	logFile, err := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
-	if err != nil {
-		panic("Failed to open log file for writing: " + err.Error())
+	switch e.Type {
+	case ModAdded:
+		e.New = &ModFile{Name: e.Name}
+	case ModDeleted:
+		e.Old = &ModFile{Name: e.Name}
+	case ModUpdated:
+		if oldName, newName, ok := strings.Cut(e.Name, " → "); ok {
+			e.Old = &ModFile{Name: oldName}
+			e.New = &ModFile{Name: newName}
+			e.Name = newName
+		}
 	}
+	return e
+}
 
-	multiWriter := io.MultiWriter(os.Stdout, logFile)
-
-	location, err := time.LoadLocation("America/Sao_Paulo")
-	if err != nil {
-		log.Fatal("Failed to load location: ", err)
-	}
+func SetupConfigChangelog(dir string) {
+	_ = os.MkdirAll(dir, 0o755)
+	configlog = &ConfigChangelog{dailyLog{dir: dir}}
+	configlog.rotateIfNeeded()
+}
 
-	opts := &slog.HandlerOptions{
-		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
-			if a.Key == slog.TimeKey {
-				t := a.Value.Time().In(location)
-				a.Value = slog.StringValue(t.Format(time.RFC3339))
-			}
-			return a
-		},
-		Level: slog.LevelDebug,
+func LogConfigChange(entry ConfigChangeEntry) ConfigChangeEntry {
+	if !entry.Type.IsValid() {
+		slog.Warn("Invalid config change type", "type", entry.Type)
+		return ConfigChangeEntry{}
 	}
 
-	logger := slog.New(slog.NewJSONHandler(multiWriter, opts))
-	slog.SetDefault(logger)
+	entry.Time = time.Now().Format(time.RFC3339)
+	configlog.write(entry)
+	return entry
 }
 
-func SetupModlistChangelog(dir string) {
+func SetupPlayerListChangelog(dir string) {
 	_ = os.MkdirAll(dir, 0o755)
-	modlog = &ModChangelog{dir: dir}
-	modlog.rotateIfNeeded()
+	playerListlog = &PlayerListChangelog{dailyLog{dir: dir}}
+	playerListlog.rotateIfNeeded()
 }
 
-func LogModChange(name string, changeType ModChangeType) ModChangeEntry {
-	if !changeType.IsValid() {
-		slog.Warn("Invalid mod change type", "type", changeType)
-		return ModChangeEntry{}
-	}
-
-	entry := ModChangeEntry{
-		Time: time.Now().Format(time.RFC3339),
-		Name: name,
-		Type: changeType,
-	}
+func LogPlayerListChange(entry PlayerListChangeEntry) PlayerListChangeEntry {
+	entry.Time = time.Now().Format(time.RFC3339)
+	playerListlog.write(entry)
+	return entry
+}
 
-	modlog.mu.Lock()
-	defer modlog.mu.Unlock()
+func (l *dailyLog) write(entry any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
 
-	modlog.rotateIfNeeded()
+	l.rotateIfNeeded()
 
-	_ = json.NewEncoder(modlog.current).Encode(entry)
-	return entry
+	_ = json.NewEncoder(l.current).Encode(entry)
 }
 
-func (l *ModChangelog) rotateIfNeeded() {
+func (l *dailyLog) rotateIfNeeded() {
 	today := time.Now().Format("2006-01-02")
 	if today == l.date {
 		return
@@ -118,7 +206,7 @@ func (l *ModChangelog) rotateIfNeeded() {
 	path := filepath.Join(l.dir, today+".log")
 	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
 	if err != nil {
-		panic("cannot open mod changelog: " + err.Error())
+		panic("cannot open changelog: " + err.Error())
 	}
 
 	l.current = f
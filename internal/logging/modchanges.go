@@ -0,0 +1,290 @@
+package logging
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/vnxcius/mcpanel-back/internal/db"
+)
+
+/*
+ModChangeQuery filters the mod changelog. Zero values match everything.
+Cursor is the ID of the last entry of the previous page.
+*/
+type ModChangeQuery struct {
+	Types  []ModChangeType
+	From   time.Time
+	To     time.Time
+	Name   string
+	Actor  string
+	Cursor int64
+	Limit  int
+}
+
+type ModChangePage struct {
+	Changes    []ModChangeEntry `json:"changes"`
+	NextCursor int64            `json:"nextCursor,omitempty"`
+}
+
+const modChangeColumns = `id, changed_at, type, name, actor_kind, actor_name, ip, old_file, new_file, comment`
+
+/*
+Stores a mod change and returns it with its ID and time filled in.
+*/
+func LogModChange(entry ModChangeEntry) ModChangeEntry {
+	if !entry.Type.IsValid() {
+		slog.Warn("Invalid mod change type", "type", entry.Type)
+		return ModChangeEntry{}
+	}
+
+	entry.Time = time.Now().Format(time.RFC3339)
+
+	id, err := insertModChange(db.DBConn, entry, "")
+	if err != nil {
+		// keep the change in the system log so it isn't lost entirely
+		slog.Error("Failed to store mod change", "error", err, "change", entry)
+		return entry
+	}
+
+	entry.ID = id
+	return entry
+}
+
+/*
+Returns a page of mod changes matching q, newest first.
+*/
+func QueryModChanges(q ModChangeQuery) (ModChangePage, error) {
+	var (
+		where []string
+		args  []any
+	)
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if len(q.Types) > 0 {
+		types := make([]string, len(q.Types))
+		for i, t := range q.Types {
+			types[i] = arg(string(t))
+		}
+		where = append(where, "type IN ("+strings.Join(types, ", ")+")")
+	}
+	if !q.From.IsZero() {
+		where = append(where, "changed_at >= "+arg(q.From))
+	}
+	if !q.To.IsZero() {
+		where = append(where, "changed_at <= "+arg(q.To))
+	}
+	if q.Name != "" {
+		p := arg(likePattern(q.Name))
+		where = append(where, fmt.Sprintf(
+			"(lower(name) LIKE %[1]s OR lower(old_file->>'name') LIKE %[1]s OR lower(new_file->>'name') LIKE %[1]s)", p,
+		))
+	}
+	if q.Actor != "" {
+		where = append(where, "lower(actor_name) LIKE "+arg(likePattern(q.Actor)))
+	}
+	if q.Cursor > 0 {
+		where = append(where, "id < "+arg(q.Cursor))
+	}
+
+	query := `SELECT ` + modChangeColumns + ` FROM "ModChange"`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY id DESC"
+	if q.Limit > 0 {
+		// one extra row tells whether there is a next page
+		query += " LIMIT " + arg(q.Limit+1)
+	}
+
+	changes, err := queryModChanges(query, args...)
+	if err != nil {
+		return ModChangePage{}, err
+	}
+
+	page := ModChangePage{Changes: changes}
+	if q.Limit > 0 && len(changes) > q.Limit {
+		page.Changes = changes[:q.Limit]
+		page.NextCursor = page.Changes[q.Limit-1].ID
+	}
+	return page, nil
+}
+
+/*
+Imports the daily JSONL files the changelog used to be written to. Each
+file is imported once, in a transaction, and remembered in the
+ModChangeImport table, so this is safe to run on every startup.
+*/
+func ImportModChangelogFiles(dir string) error {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name() < files[j].Name()
+	})
+
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".log") {
+			continue
+		}
+
+		var exists bool
+		err := db.DBConn.QueryRow(
+			`SELECT EXISTS (SELECT 1 FROM "ModChangeImport" WHERE file = $1)`, file.Name(),
+		).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+
+		n, err := importModChangelogFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return fmt.Errorf("importing %s: %w", file.Name(), err)
+		}
+		slog.Info("Imported mod changelog file", "file", file.Name(), "entries", n)
+	}
+
+	return nil
+}
+
+func importModChangelogFile(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	tx, err := db.DBConn.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	n := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry ModChangeEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil || !entry.Type.IsValid() {
+			continue
+		}
+		if _, err := insertModChange(tx, entry.Normalized(), filepath.Base(path)); err != nil {
+			return 0, err
+		}
+		n++
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(
+		`INSERT INTO "ModChangeImport" (file, entries) VALUES ($1, $2)`, filepath.Base(path), n,
+	); err != nil {
+		return 0, err
+	}
+
+	return n, tx.Commit()
+}
+
+type rowQuerier interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+func insertModChange(conn rowQuerier, e ModChangeEntry, importedFrom string) (int64, error) {
+	t, err := time.Parse(time.RFC3339, e.Time)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q: %w", e.Time, err)
+	}
+
+	var actorKind, actorName sql.NullString
+	if e.Actor != nil {
+		actorKind = sql.NullString{String: string(e.Actor.Kind), Valid: true}
+		actorName = sql.NullString{String: e.Actor.Name, Valid: true}
+	}
+
+	var id int64
+	err = conn.QueryRow(
+		`INSERT INTO "ModChange"
+			(changed_at, type, name, actor_kind, actor_name, ip, old_file, new_file, comment, imported_from)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id`,
+		t, string(e.Type), e.Name, actorKind, actorName, e.IP,
+		jsonColumn(e.Old), jsonColumn(e.New), e.Comment, importedFrom,
+	).Scan(&id)
+	return id, err
+}
+
+func queryModChanges(query string, args ...any) ([]ModChangeEntry, error) {
+	rows, err := db.DBConn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []ModChangeEntry{}
+	for rows.Next() {
+		var (
+			e                    ModChangeEntry
+			t                    time.Time
+			changeType           string
+			actorKind, actorName sql.NullString
+			oldFile, newFile     []byte
+		)
+		err := rows.Scan(
+			&e.ID, &t, &changeType, &e.Name, &actorKind, &actorName,
+			&e.IP, &oldFile, &newFile, &e.Comment,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		e.Time = t.Local().Format(time.RFC3339)
+		e.Type = ModChangeType(changeType)
+		if actorKind.Valid {
+			e.Actor = &Actor{Kind: ActorKind(actorKind.String), Name: actorName.String}
+		}
+		if oldFile != nil {
+			e.Old = &ModFile{}
+			_ = json.Unmarshal(oldFile, e.Old)
+		}
+		if newFile != nil {
+			e.New = &ModFile{}
+			_ = json.Unmarshal(newFile, e.New)
+		}
+
+		changes = append(changes, e)
+	}
+	return changes, rows.Err()
+}
+
+func jsonColumn(f *ModFile) any {
+	if f == nil {
+		return nil
+	}
+	data, err := json.Marshal(f)
+	if err != nil {
+		return nil
+	}
+	return string(data)
+}
+
+func likePattern(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(strings.ToLower(s))
+	return "%" + s + "%"
+}
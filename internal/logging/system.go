@@ -0,0 +1,460 @@
+package logging
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+SystemLogOptions configures the panel's own log. The file is rotated when
+it grows past MaxSize bytes or has been written to for longer than
+Interval, and on every startup so the previous run is kept as it ended.
+Rotated files are gzipped and removed once older than MaxAge.
+*/
+type SystemLogOptions struct {
+	MaxSize  int64
+	Interval time.Duration
+	MaxAge   time.Duration
+	Level    slog.Level
+	Location *time.Location
+}
+
+// SystemLogFile is the current system log or one of its archives
+type SystemLogFile struct {
+	Name       string    `json:"name"`
+	Size       int64     `json:"size"`
+	Modified   time.Time `json:"modified"`
+	Compressed bool      `json:"compressed"`
+}
+
+/*
+SystemLogQuery filters system log records. Text is matched against the
+whole JSON line and Level is the minimum level, info when left zero as in
+slog. Zero times leave the range open.
+*/
+type SystemLogQuery struct {
+	Text  string
+	Level slog.Level
+	From  time.Time
+	To    time.Time
+	Limit int
+}
+
+const archiveLayout = "2006-01-02T15-04-05.000"
+
+var (
+	ErrUnknownLevel = errors.New("unknown log level")
+
+	systemLevel = new(slog.LevelVar)
+	systemLog   *rotatingFile
+)
+
+type rotatingFile struct {
+	mu       sync.Mutex
+	path     string
+	opts     SystemLogOptions
+	file     *os.File
+	size     int64
+	openedAt time.Time
+
+	// archives are compressed one at a time
+	compressing sync.Mutex
+}
+
+func SetupLogger(filePath string, opts SystemLogOptions) {
+	logDir := filepath.Dir(filePath)
+	err := os.MkdirAll(logDir, 0755)
+	if err != nil {
+		panic("Failed to create log directory: " + err.Error())
+	}
+
+	if opts.Location == nil {
+		opts.Location = time.Local
+	}
+	systemLevel.Set(opts.Level)
+
+	systemLog = &rotatingFile{path: filePath, opts: opts}
+	// keep the previous run's log instead of writing after it, it's
+	// compressed with any other leftovers below
+	if info, err := os.Stat(filePath); err == nil && info.Size() > 0 {
+		if err := os.Rename(filePath, systemLog.archivePath(time.Now())); err != nil {
+			panic("Failed to rotate log file: " + err.Error())
+		}
+	}
+	if err := systemLog.open(); err != nil {
+		panic("Failed to open log file for writing: " + err.Error())
+	}
+
+	multiWriter := io.MultiWriter(os.Stdout, systemLog)
+
+	handlerOpts := &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				t := a.Value.Time().In(opts.Location)
+				a.Value = slog.StringValue(t.Format(time.RFC3339))
+			}
+			return a
+		},
+		Level: systemLevel,
+	}
+
+	logger := slog.New(slog.NewJSONHandler(multiWriter, handlerOpts))
+	slog.SetDefault(logger)
+
+	go systemLog.compressLeftovers()
+}
+
+// Returns the current minimum level of the system log
+func Level() string {
+	return strings.ToLower(systemLevel.Level().String())
+}
+
+/*
+Changes the minimum level of the system log. Accepts debug, info, warn
+and error.
+*/
+func SetLevel(level string) error {
+	l, err := ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	systemLevel.Set(l)
+	return nil
+}
+
+// Parses a level name, as accepted by SetLevel, in any case
+func ParseLevel(level string) (slog.Level, error) {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "warn":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return 0, ErrUnknownLevel
+	}
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+	if f.size > 0 && (f.size+int64(len(p)) > f.opts.MaxSize && f.opts.MaxSize > 0 ||
+		f.opts.Interval > 0 && time.Since(f.openedAt) > f.opts.Interval) {
+		f.rotate()
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	f.file, f.size, f.openedAt = file, info.Size(), time.Now()
+	return nil
+}
+
+/*
+Moves the current file aside and starts a new one. Compressing and pruning
+happen in the background. Errors go to stderr, the log itself being what
+failed.
+*/
+func (f *rotatingFile) rotate() {
+	f.file.Close()
+	f.file = nil
+
+	archive := f.archivePath(time.Now())
+	if err := os.Rename(f.path, archive); err != nil {
+		os.Stderr.WriteString("failed to rotate system log: " + err.Error() + "\n")
+	} else {
+		go f.compress(archive)
+	}
+
+	if err := f.open(); err != nil {
+		os.Stderr.WriteString("failed to reopen system log: " + err.Error() + "\n")
+	}
+}
+
+// system.log -> system-2024-06-22T14-03-11.000.log
+func (f *rotatingFile) archivePath(t time.Time) string {
+	ext := filepath.Ext(f.path)
+	base := strings.TrimSuffix(f.path, ext)
+	for {
+		path := base + "-" + t.Format(archiveLayout) + ext
+		if !exists(path) && !exists(path+".gz") {
+			return path
+		}
+		t = t.Add(time.Millisecond)
+	}
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func (f *rotatingFile) compress(path string) {
+	f.compressing.Lock()
+	err := gzipFile(path)
+	f.compressing.Unlock()
+	// already compressed with the leftovers
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		os.Stderr.WriteString("failed to compress system log: " + err.Error() + "\n")
+	}
+	f.prune()
+}
+
+// Compresses archives left uncompressed, such as the previous run's log
+func (f *rotatingFile) compressLeftovers() {
+	files, err := f.archives()
+	if err != nil {
+		return
+	}
+	f.compressing.Lock()
+	for _, name := range files {
+		if !strings.HasSuffix(name, ".gz") {
+			_ = gzipFile(filepath.Join(filepath.Dir(f.path), name))
+		}
+	}
+	f.compressing.Unlock()
+	f.prune()
+}
+
+func (f *rotatingFile) prune() {
+	if f.opts.MaxAge <= 0 {
+		return
+	}
+
+	files, err := f.archives()
+	if err != nil {
+		return
+	}
+	dir := filepath.Dir(f.path)
+	for _, name := range files {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err == nil && time.Since(info.ModTime()) > f.opts.MaxAge {
+			_ = os.Remove(filepath.Join(dir, name))
+		}
+	}
+}
+
+// Names of the rotated files, newest first
+func (f *rotatingFile) archives() ([]string, error) {
+	ext := filepath.Ext(f.path)
+	prefix := strings.TrimSuffix(filepath.Base(f.path), ext) + "-"
+
+	entries, err := os.ReadDir(filepath.Dir(f.path))
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, e := range entries {
+		name := e.Name()
+		stamp := strings.TrimSuffix(strings.TrimSuffix(name, ".gz"), ext)
+		if e.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if _, err := time.Parse(archiveLayout, strings.TrimPrefix(stamp, prefix)); err != nil {
+			continue
+		}
+		names = append(names, name)
+	}
+
+	// the timestamp format sorts by name
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+	return names, nil
+}
+
+/*
+Replaces path with a gzipped copy. The copy keeps the file's modification
+time, which is what archives are pruned by.
+*/
+func gzipFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	dst, err := os.Create(path + ".gz")
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, src); err != nil {
+		dst.Close()
+		os.Remove(dst.Name())
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		dst.Close()
+		os.Remove(dst.Name())
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	if err := os.Chtimes(dst.Name(), info.ModTime(), info.ModTime()); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+/*
+Lists the system log and its archives, newest first.
+*/
+func SystemLogFiles() ([]SystemLogFile, error) {
+	names, err := systemLog.archives()
+	if err != nil {
+		return nil, err
+	}
+	names = append([]string{filepath.Base(systemLog.path)}, names...)
+
+	files := []SystemLogFile{}
+	for _, name := range names {
+		info, err := os.Stat(filepath.Join(filepath.Dir(systemLog.path), name))
+		if err != nil {
+			continue
+		}
+		files = append(files, SystemLogFile{
+			Name:       name,
+			Size:       info.Size(),
+			Modified:   info.ModTime(),
+			Compressed: strings.HasSuffix(name, ".gz"),
+		})
+	}
+	return files, nil
+}
+
+/*
+Returns the newest records matching q, newest first, reading the current
+file and then older archives until Limit records are found.
+*/
+func SearchSystemLog(q SystemLogQuery) ([]map[string]any, error) {
+	files, err := SystemLogFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	text := strings.ToLower(q.Text)
+	records := []map[string]any{}
+
+	for _, file := range files {
+		if !q.From.IsZero() && file.Modified.Before(q.From) {
+			break
+		}
+
+		// newest matches of this file, oldest first
+		matches, err := searchSystemLogFile(file, q, text)
+		if err != nil {
+			return nil, err
+		}
+		for i := len(matches) - 1; i >= 0 && len(records) < q.Limit; i-- {
+			records = append(records, matches[i])
+		}
+		if len(records) >= q.Limit {
+			break
+		}
+	}
+	return records, nil
+}
+
+func searchSystemLogFile(file SystemLogFile, q SystemLogQuery, text string) ([]map[string]any, error) {
+	f, err := os.Open(filepath.Join(filepath.Dir(systemLog.path), file.Name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			// rotated away while searching
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if file.Compressed {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	// only the last Limit matches are kept
+	var matches []map[string]any
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if text != "" && !strings.Contains(strings.ToLower(string(line)), text) {
+			continue
+		}
+
+		var record map[string]any
+		if err := json.Unmarshal(line, &record); err != nil {
+			continue
+		}
+		if !systemRecordMatches(record, q) {
+			continue
+		}
+
+		matches = append(matches, record)
+		if len(matches) > q.Limit {
+			matches = matches[1:]
+		}
+	}
+	return matches, scanner.Err()
+}
+
+func systemRecordMatches(record map[string]any, q SystemLogQuery) bool {
+	if levelName, ok := record[slog.LevelKey].(string); ok {
+		if level, err := ParseLevel(levelName); err == nil && level < q.Level {
+			return false
+		}
+	}
+
+	if q.From.IsZero() && q.To.IsZero() {
+		return true
+	}
+	value, _ := record[slog.TimeKey].(string)
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return false
+	}
+	return (q.From.IsZero() || !t.Before(q.From)) && (q.To.IsZero() || !t.After(q.To))
+}
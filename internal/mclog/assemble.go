@@ -0,0 +1,77 @@
+package mclog
+
+import "time"
+
+/*
+Assembler joins stack traces and other continuation lines to the entry
+they follow. An entry is only complete once the next one starts, so live
+readers should call Flush when no line has arrived for a while.
+*/
+type Assembler struct {
+	parser  *lineParser
+	pending *Entry
+}
+
+/*
+Creates an assembler for lines written on day or later.
+*/
+func NewAssembler(day time.Time) *Assembler {
+	return &Assembler{parser: newLineParser(startOfDay(day))}
+}
+
+/*
+Adds a line and returns the previous entry if the line starts a new one.
+*/
+func (a *Assembler) Add(line string) (Entry, bool) {
+	e, isHeader := a.parser.parse(line)
+
+	if !isHeader && a.pending != nil {
+		a.pending.Stack = append(a.pending.Stack, line)
+		return Entry{}, false
+	}
+
+	done, ok := a.Flush()
+	a.pending = &e
+	return done, ok
+}
+
+/*
+Returns the entry being assembled, if any, and starts over.
+*/
+func (a *Assembler) Flush() (Entry, bool) {
+	if a.pending == nil {
+		return Entry{}, false
+	}
+	e := *a.pending
+	a.pending = nil
+	return e, true
+}
+
+/*
+Parses the last lines of a log whose final line was written on lastDay.
+*/
+func ParseTail(lines []string, lastDay time.Time) []Entry {
+	var c rolloverCounter
+	for _, line := range lines {
+		c.add(line)
+	}
+
+	a := NewAssembler(startOfDay(lastDay).AddDate(0, 0, -c.n))
+	entries := []Entry{}
+	for _, line := range lines {
+		if e, ok := a.Add(line); ok {
+			entries = append(entries, e)
+		}
+	}
+	if e, ok := a.Flush(); ok {
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+/*
+Returns the raw lines of e, its own followed by the ones joined to it.
+*/
+func (e Entry) Lines() []string {
+	return append([]string{e.Raw}, e.Stack...)
+}
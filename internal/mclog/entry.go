@@ -0,0 +1,178 @@
+package mclog
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+Entry is one parsed line of a Minecraft server log. Lines that don't start
+with a Log4j header, like stack trace lines, keep the fields of the entry
+they belong to. Entries put together by an Assembler carry those lines in
+Stack instead.
+*/
+type Entry struct {
+	Time    time.Time `json:"time"`
+	Thread  string    `json:"thread"`
+	Level   string    `json:"level"`
+	Logger  string    `json:"logger,omitempty"`
+	Message string    `json:"message"`
+	Raw     string    `json:"raw"`
+	Stack   []string  `json:"stack,omitempty"`
+}
+
+var (
+	// [12:34:56] [Server thread/INFO] [minecraft/DedicatedServer]: message
+	// [22Jun2024 14:03:11.123] [main/INFO] [cpw.mods.modlauncher.Launcher/MODLAUNCHER]: message
+	headerPattern = regexp.MustCompile(
+		`^\[(?:(\d{2}[A-Za-z]{3}\d{4}) )?(\d{2}):(\d{2}):(\d{2})(?:\.(\d{3}))?\] \[([^\]]*)/([A-Z]+)\](?: \[([^\]]*)\])?: ?(.*)$`,
+	)
+	// [12:34:56 INFO]: message, as written by Bukkit based servers
+	bukkitHeaderPattern = regexp.MustCompile(
+		`^\[(\d{2}):(\d{2}):(\d{2}) ([A-Z]+)\]:? ?(.*)$`,
+	)
+)
+
+type header struct {
+	date    time.Time
+	clock   time.Duration
+	thread  string
+	level   string
+	logger  string
+	message string
+}
+
+func parseHeader(line string) (header, bool) {
+	if m := headerPattern.FindStringSubmatch(line); m != nil {
+		h := header{
+			clock:   clock(m[2], m[3], m[4], m[5]),
+			thread:  m[6],
+			level:   m[7],
+			logger:  m[8],
+			message: m[9],
+		}
+		if m[1] != "" {
+			h.date, _ = time.ParseInLocation("02Jan2006", m[1], time.Local)
+		}
+		return h, true
+	}
+
+	if m := bukkitHeaderPattern.FindStringSubmatch(line); m != nil {
+		return header{
+			clock:   clock(m[1], m[2], m[3], ""),
+			level:   m[4],
+			message: m[5],
+		}, true
+	}
+
+	return header{}, false
+}
+
+func clock(hour, min, sec, milli string) time.Duration {
+	h, _ := strconv.Atoi(hour)
+	m, _ := strconv.Atoi(min)
+	s, _ := strconv.Atoi(sec)
+	ms, _ := strconv.Atoi(milli)
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute +
+		time.Duration(s)*time.Second + time.Duration(ms)*time.Millisecond
+}
+
+/*
+Turns the lines of one log file into entries. Most formats only carry the
+time of day, so lines are placed on day, moving to the next day whenever
+the clock goes back.
+*/
+type lineParser struct {
+	day       time.Time
+	lastClock time.Duration
+	current   Entry
+}
+
+func newLineParser(day time.Time) *lineParser {
+	return &lineParser{day: day, current: Entry{Time: day}}
+}
+
+// The returned bool is false for lines continuing the previous entry
+func (p *lineParser) parse(line string) (Entry, bool) {
+	h, ok := parseHeader(line)
+	if !ok {
+		e := p.current
+		e.Message = line
+		e.Raw = line
+		return e, false
+	}
+
+	switch {
+	case !h.date.IsZero():
+		p.day = h.date
+	case h.clock < p.lastClock:
+		p.day = p.day.AddDate(0, 0, 1)
+	}
+	p.lastClock = h.clock
+
+	p.current = Entry{
+		Time:    p.day.Add(h.clock),
+		Thread:  h.thread,
+		Level:   h.level,
+		Logger:  h.logger,
+		Message: h.message,
+		Raw:     line,
+	}
+	return p.current, true
+}
+
+/*
+Counts how many times the clock goes back in a log file, which is how many
+days it spans after the first one.
+*/
+func countRollovers(ctx context.Context, r io.Reader) (int, error) {
+	var c rolloverCounter
+	lines := 0
+	err := readLines(r, func(line string) error {
+		lines++
+		if lines%1000 == 0 && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		c.add(line)
+		return nil
+	})
+	return c.n, err
+}
+
+type rolloverCounter struct {
+	n    int
+	last time.Duration
+}
+
+func (c *rolloverCounter) add(line string) {
+	if h, ok := parseHeader(line); ok {
+		if h.clock < c.last {
+			c.n++
+		}
+		c.last = h.clock
+	}
+}
+
+// Calls fn for every line of r, stopping at the first error
+func readLines(r io.Reader, fn func(line string) error) error {
+	br := bufio.NewReaderSize(r, 64*1024)
+	for {
+		line, err := br.ReadString('\n')
+		if len(line) > 0 {
+			if ferr := fn(strings.TrimRight(line, "\r\n")); ferr != nil {
+				return ferr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
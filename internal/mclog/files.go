@@ -0,0 +1,227 @@
+package mclog
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+LogFile is a file in the Minecraft logs directory: latest.log, debug.log
+or one of the archives they are rotated into, named like
+2024-05-01-3.log.gz.
+*/
+type LogFile struct {
+	Name       string    `json:"name"`
+	Size       int64     `json:"size"`
+	Modified   time.Time `json:"modified"`
+	Compressed bool      `json:"compressed"`
+
+	path  string
+	date  time.Time
+	index int
+}
+
+var (
+	archivePattern = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2})-(\d+)\.log\.gz$`)
+	logNamePattern = regexp.MustCompile(`^[\w.-]+\.log(\.gz)?$`)
+
+	ErrNotFound    = errors.New("log file not found")
+	ErrInvalidName = errors.New("invalid log file name")
+)
+
+/*
+Lists the log archives next to latest, oldest first, followed by latest
+itself if it exists.
+*/
+func Files(latest string) ([]LogFile, error) {
+	dir := filepath.Dir(latest)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []LogFile{}
+	for _, entry := range entries {
+		m := archivePattern.FindStringSubmatch(entry.Name())
+		if m == nil || !entry.Type().IsRegular() {
+			continue
+		}
+
+		date, err := time.ParseInLocation(time.DateOnly, m[1], time.Local)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		index, _ := strconv.Atoi(m[2])
+
+		files = append(files, LogFile{
+			Name:       entry.Name(),
+			Size:       info.Size(),
+			Modified:   info.ModTime(),
+			Compressed: true,
+			path:       filepath.Join(dir, entry.Name()),
+			date:       date,
+			index:      index,
+		})
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		if !files[i].date.Equal(files[j].date) {
+			return files[i].date.Before(files[j].date)
+		}
+		return files[i].index < files[j].index
+	})
+
+	if info, err := os.Stat(latest); err == nil {
+		files = append(files, LogFile{
+			Name:     filepath.Base(latest),
+			Size:     info.Size(),
+			Modified: info.ModTime(),
+			path:     latest,
+			date:     startOfDay(info.ModTime()),
+		})
+	}
+
+	return files, nil
+}
+
+/*
+Lists every log in dir, like latest.log, debug.log and their archives,
+newest first.
+*/
+func ListDir(dir string) ([]LogFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []LogFile{}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !logNamePattern.MatchString(entry.Name()) {
+			continue
+		}
+		if f, err := Lookup(dir, entry.Name()); err == nil {
+			files = append(files, f)
+		}
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Modified.After(files[j].Modified)
+	})
+	return files, nil
+}
+
+/*
+Finds the log called name in dir. Names are plain file names, anything
+that could point outside dir is rejected.
+*/
+func Lookup(dir, name string) (LogFile, error) {
+	if !logNamePattern.MatchString(name) || name != filepath.Base(name) {
+		return LogFile{}, ErrInvalidName
+	}
+
+	path := filepath.Join(dir, name)
+	info, err := os.Lstat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return LogFile{}, ErrNotFound
+		}
+		return LogFile{}, err
+	}
+	if !info.Mode().IsRegular() {
+		return LogFile{}, ErrNotFound
+	}
+
+	return LogFile{
+		Name:       name,
+		Size:       info.Size(),
+		Modified:   info.ModTime(),
+		Compressed: strings.HasSuffix(name, ".gz"),
+		path:       path,
+		date:       startOfDay(info.ModTime()),
+	}, nil
+}
+
+// Path of the file on disk, as stored
+func (f LogFile) Path() string {
+	return f.path
+}
+
+/*
+Opens a log file for reading, decompressing archives.
+*/
+func (f LogFile) Open() (io.ReadCloser, error) {
+	file, err := os.Open(f.path)
+	if err != nil {
+		return nil, err
+	}
+	if !f.Compressed {
+		return file, nil
+	}
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &gzipFile{Reader: gz, file: file}, nil
+}
+
+/*
+Returns the day the first line of the file was written on. Minecraft rolls
+its log over at midnight, so an archive holds a single day, the one in its
+name. latest.log is checked for midnight crossings anyway in case the
+server runs with a different Log4j config.
+*/
+func (f LogFile) firstDay(ctx context.Context) (time.Time, error) {
+	if f.Compressed {
+		return f.date, nil
+	}
+
+	r, err := f.Open()
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer r.Close()
+
+	n, err := countRollovers(ctx, r)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return f.date.AddDate(0, 0, -n), nil
+}
+
+// lastDay is the last day the file can hold lines from
+func (f LogFile) lastDay() time.Time {
+	if f.Compressed {
+		return f.date
+	}
+	return startOfDay(f.Modified)
+}
+
+type gzipFile struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (g *gzipFile) Close() error {
+	g.Reader.Close()
+	return g.file.Close()
+}
+
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
@@ -0,0 +1,141 @@
+package mclog
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strings"
+)
+
+// size of the blocks read backwards when looking for the last lines
+const tailBlockSize = 64 * 1024
+
+/*
+Returns the last n lines of the file at path. The file is read backwards
+from its end, so only the part holding those lines is loaded.
+*/
+func LastLines(path string, n int) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return lastLines(f, info.Size(), n)
+}
+
+func lastLines(r io.ReaderAt, size int64, n int) ([]string, error) {
+	if n <= 0 || size == 0 {
+		return []string{}, nil
+	}
+
+	var data []byte
+	offset := size
+	for offset > 0 {
+		block := int64(tailBlockSize)
+		if offset < block {
+			block = offset
+		}
+		offset -= block
+
+		buf := make([]byte, block)
+		if _, err := r.ReadAt(buf, offset); err != nil && err != io.EOF {
+			return nil, err
+		}
+		data = append(buf, data...)
+
+		// a trailing newline ends the last line, it doesn't start a new one
+		if bytes.Count(bytes.TrimSuffix(data, []byte("\n")), []byte("\n")) >= n {
+			break
+		}
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if offset > 0 {
+		// the first line may have been cut in half
+		lines = lines[1:]
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+	return lines, nil
+}
+
+/*
+Returns up to count lines starting at line from, counting from 1, and
+whether the file has more lines after them. Lines before from are read
+but not kept.
+*/
+func (f LogFile) Lines(from, count int) ([]string, bool, error) {
+	r, err := f.Open()
+	if err != nil {
+		return nil, false, err
+	}
+	defer r.Close()
+
+	lines := []string{}
+	more := false
+	n := 0
+	errDone := errors.New("enough lines")
+
+	err = readLines(r, func(line string) error {
+		n++
+		if n < from {
+			return nil
+		}
+		if len(lines) == count {
+			more = true
+			return errDone
+		}
+		lines = append(lines, line)
+		return nil
+	})
+	if err != nil && !errors.Is(err, errDone) {
+		return nil, false, err
+	}
+	return lines, more, nil
+}
+
+/*
+Returns the last n lines of the file. Plain files are read backwards from
+the end; archives can't be, so they are decompressed keeping only the
+last n lines in memory.
+*/
+func (f LogFile) Tail(n int) ([]string, error) {
+	if n <= 0 {
+		return []string{}, nil
+	}
+	if !f.Compressed {
+		return LastLines(f.path, n)
+	}
+
+	r, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	ring := make([]string, 0, n)
+	start := 0
+	err = readLines(r, func(line string) error {
+		if len(ring) < n {
+			ring = append(ring, line)
+			return nil
+		}
+		ring[start] = line
+		start = (start + 1) % n
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append(ring[start:], ring[:start]...), nil
+}
@@ -0,0 +1,193 @@
+package mclog
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+var ErrInvalidPattern = errors.New("invalid search pattern")
+
+// stop reasons reported in SearchResult
+const (
+	StopLimit    = "limit"
+	StopTimeout  = "timeout"
+	StopCanceled = "canceled"
+)
+
+/*
+SearchQuery filters log lines. Text is matched against the whole raw line,
+as a regular expression if Regex is set. Zero values match everything.
+*/
+type SearchQuery struct {
+	Text       string
+	Regex      bool
+	IgnoreCase bool
+	From       time.Time
+	To         time.Time
+	Levels     []string
+	Thread     string
+	Limit      int
+	Timeout    time.Duration
+}
+
+type Match struct {
+	File string `json:"file"`
+	Line int    `json:"line"`
+	Entry
+}
+
+type SearchResult struct {
+	Matches   int    `json:"matches"`
+	Files     int    `json:"files"`
+	Truncated bool   `json:"truncated"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+/*
+Searches latest and its rotated archives, oldest first, calling fn with
+every match as it is found. The search stops after Limit matches, after
+Timeout, when ctx is canceled or when fn returns an error.
+*/
+func Search(ctx context.Context, latest string, q SearchQuery, fn func(Match) error) (SearchResult, error) {
+	match, err := q.matcher()
+	if err != nil {
+		return SearchResult{}, err
+	}
+
+	if q.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, q.Timeout)
+		defer cancel()
+	}
+
+	files, err := Files(latest)
+	if err != nil {
+		return SearchResult{}, err
+	}
+
+	var res SearchResult
+	errLimit := errors.New("limit reached")
+
+	for _, f := range files {
+		if err := ctx.Err(); err != nil {
+			res.Truncated, res.Reason = true, stopReason(err)
+			return res, nil
+		}
+		if !q.From.IsZero() && f.lastDay().AddDate(0, 0, 1).Before(q.From) {
+			continue
+		}
+
+		day, err := f.firstDay(ctx)
+		if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+			res.Truncated, res.Reason = true, stopReason(err)
+			return res, nil
+		}
+		if err != nil {
+			return res, err
+		}
+		if !q.To.IsZero() && day.After(q.To) {
+			continue
+		}
+
+		r, err := f.Open()
+		if err != nil {
+			return res, err
+		}
+		res.Files++
+
+		parser := newLineParser(day)
+		n := 0
+		err = readLines(r, func(line string) error {
+			n++
+			if n%1000 == 0 && ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			e, _ := parser.parse(line)
+			if !q.From.IsZero() && e.Time.Before(q.From) {
+				return nil
+			}
+			if !q.To.IsZero() && e.Time.After(q.To) {
+				return nil
+			}
+			if len(q.Levels) > 0 && !slices.Contains(q.Levels, e.Level) {
+				return nil
+			}
+			if q.Thread != "" && !strings.Contains(strings.ToLower(e.Thread), strings.ToLower(q.Thread)) {
+				return nil
+			}
+			if !match(line) {
+				return nil
+			}
+
+			if err := fn(Match{File: f.Name, Line: n, Entry: e}); err != nil {
+				return err
+			}
+			res.Matches++
+			if q.Limit > 0 && res.Matches >= q.Limit {
+				return errLimit
+			}
+			return nil
+		})
+		r.Close()
+
+		switch {
+		case err == nil:
+		case errors.Is(err, errLimit):
+			res.Truncated, res.Reason = true, StopLimit
+			return res, nil
+		case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+			res.Truncated, res.Reason = true, stopReason(err)
+			return res, nil
+		default:
+			return res, err
+		}
+	}
+
+	return res, nil
+}
+
+func stopReason(err error) string {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return StopTimeout
+	}
+	return StopCanceled
+}
+
+// Checks that Text compiles when it is a regular expression
+func (q SearchQuery) Validate() error {
+	_, err := q.matcher()
+	return err
+}
+
+func (q SearchQuery) matcher() (func(string) bool, error) {
+	if q.Text == "" {
+		return func(string) bool { return true }, nil
+	}
+
+	if q.Regex {
+		expr := q.Text
+		if q.IgnoreCase {
+			expr = "(?i)" + expr
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, ErrInvalidPattern
+		}
+		return re.MatchString, nil
+	}
+
+	if q.IgnoreCase {
+		text := strings.ToLower(q.Text)
+		return func(line string) bool {
+			return strings.Contains(strings.ToLower(line), text)
+		}, nil
+	}
+	return func(line string) bool {
+		return strings.Contains(line, q.Text)
+	}, nil
+}
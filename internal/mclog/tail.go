@@ -0,0 +1,218 @@
+package mclog
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// a line longer than this is sent in pieces
+const maxPartialLine = 1 << 20
+
+var (
+	// fallback for filesystems that don't deliver inotify events, like
+	// some network and container mounts
+	tailPollInterval = 2 * time.Second
+	// used instead when the directory can't be watched at all
+	tailPollOnlyInterval = 500 * time.Millisecond
+)
+
+/*
+Tail follows the file at path and sends every complete line written to it
+to out, starting at the current end of the file. Lines still being written
+are held until their newline arrives. When the file is truncated it is read
+again from the start, and when it is replaced, as Log4j does on rotation,
+the rest of the old file is read before switching to the new one. A
+missing file is waited for. If the directory can't be watched the file is
+polled instead.
+
+Tail blocks until ctx is done.
+*/
+func Tail(ctx context.Context, path string, out chan<- string) {
+	var (
+		events   <-chan fsnotify.Event
+		errs     <-chan error
+		interval = tailPollInterval
+	)
+	watcher, err := fsnotify.NewWatcher()
+	if err == nil {
+		defer watcher.Close()
+		err = watcher.Add(filepath.Dir(path))
+	}
+	if err != nil {
+		slog.Warn("Can't watch log directory, polling it instead", "path", path, "error", err)
+		interval = tailPollOnlyInterval
+	} else {
+		events, errs = watcher.Events, watcher.Errors
+	}
+
+	t := &tailer{path: path, out: out, ctx: ctx}
+	t.open(true)
+	defer t.close()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case evt, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			if filepath.Clean(evt.Name) != filepath.Clean(path) {
+				continue
+			}
+			t.check()
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			slog.Warn("Log watcher error", "path", path, "error", err)
+		case <-ticker.C:
+			t.check()
+		}
+	}
+}
+
+type tailer struct {
+	ctx     context.Context
+	path    string
+	out     chan<- string
+	file    *os.File
+	info    os.FileInfo
+	offset  int64
+	partial []byte
+}
+
+// Opens the file, at its end when starting up so old lines aren't resent
+func (t *tailer) open(atEnd bool) {
+	f, err := os.Open(t.path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			slog.Warn("Failed to open log", "path", t.path, "error", err)
+		}
+		return
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		slog.Warn("Failed to stat log", "path", t.path, "error", err)
+		return
+	}
+
+	t.file, t.info, t.offset = f, info, 0
+	if atEnd {
+		t.offset = info.Size()
+	}
+}
+
+func (t *tailer) close() {
+	if t.file != nil {
+		t.file.Close()
+		t.file = nil
+	}
+}
+
+/*
+Reads whatever was appended and deals with the file having been replaced,
+removed or truncated since the last check.
+*/
+func (t *tailer) check() {
+	if t.file == nil {
+		t.open(false)
+		if t.file == nil {
+			return
+		}
+	}
+
+	current, err := os.Stat(t.path)
+	replaced := err != nil || !os.SameFile(current, t.info)
+
+	// whatever the old file got before being replaced still belongs to it
+	t.read()
+
+	if replaced {
+		t.flushPartial()
+		t.close()
+		if err == nil {
+			t.open(false)
+			t.read()
+		}
+		return
+	}
+
+	if current.Size() < t.offset {
+		slog.Debug("Log truncated, reading from the start", "path", t.path)
+		t.flushPartial()
+		t.offset = 0
+		t.read()
+	}
+}
+
+func (t *tailer) read() {
+	if t.file == nil {
+		return
+	}
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := t.file.ReadAt(buf, t.offset)
+		if n > 0 {
+			t.offset += int64(n)
+			t.push(buf[:n])
+		}
+		if err != nil {
+			if err != io.EOF {
+				slog.Warn("Failed to read log", "path", t.path, "error", err)
+			}
+			return
+		}
+	}
+}
+
+// Splits data into lines, keeping an unfinished last line for later
+func (t *tailer) push(data []byte) {
+	t.partial = append(t.partial, data...)
+
+	for {
+		idx := bytes.IndexByte(t.partial, '\n')
+		if idx < 0 {
+			break
+		}
+		t.send(string(bytes.TrimRight(t.partial[:idx], "\r")))
+		t.partial = t.partial[idx+1:]
+	}
+
+	if len(t.partial) > maxPartialLine {
+		t.flushPartial()
+	}
+	if len(t.partial) == 0 {
+		t.partial = nil
+	}
+}
+
+func (t *tailer) flushPartial() {
+	if len(t.partial) > 0 {
+		t.send(string(bytes.TrimRight(t.partial, "\r")))
+	}
+	t.partial = nil
+}
+
+func (t *tailer) send(line string) {
+	select {
+	case t.out <- line:
+	case <-t.ctx.Done():
+	}
+}
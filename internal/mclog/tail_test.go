@@ -0,0 +1,144 @@
+package mclog
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Starts tailing path and gives Tail a moment to open it at its end
+func startTail(t *testing.T, path string) <-chan string {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	out := make(chan string, 100)
+	done := make(chan struct{})
+	go func() {
+		Tail(ctx, path, out)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	time.Sleep(200 * time.Millisecond)
+	return out
+}
+
+func expectLines(t *testing.T, out <-chan string, want ...string) {
+	t.Helper()
+	for _, w := range want {
+		select {
+		case got := <-out:
+			if got != w {
+				t.Fatalf("got line %q, want %q", got, w)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %q", w)
+		}
+	}
+}
+
+func expectNoLine(t *testing.T, out <-chan string) {
+	t.Helper()
+	select {
+	case got := <-out:
+		t.Fatalf("got unexpected line %q", got)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func appendFile(t *testing.T, path, data string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTailStartsAtEnd(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "latest.log")
+	appendFile(t, path, "old line\n")
+
+	out := startTail(t, path)
+	appendFile(t, path, "new line\n")
+	expectLines(t, out, "new line")
+}
+
+func TestTailHoldsPartialLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "latest.log")
+	appendFile(t, path, "")
+
+	out := startTail(t, path)
+	appendFile(t, path, "hello wor")
+	expectNoLine(t, out)
+
+	appendFile(t, path, "ld\r\nsecond\n")
+	expectLines(t, out, "hello world", "second")
+}
+
+func TestTailTruncation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "latest.log")
+	appendFile(t, path, "")
+
+	out := startTail(t, path)
+	appendFile(t, path, "first\nsecond\n")
+	expectLines(t, out, "first", "second")
+
+	if err := os.Truncate(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, path, "after\n")
+	expectLines(t, out, "after")
+}
+
+func TestTailRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "latest.log")
+	appendFile(t, path, "")
+
+	out := startTail(t, path)
+	appendFile(t, path, "one\n")
+	expectLines(t, out, "one")
+
+	// the old file's last lines come before the new file's
+	appendFile(t, path, "last of old\n")
+	if err := os.Rename(path, filepath.Join(dir, "2024-01-01-1.log")); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, path, "first of new\n")
+	expectLines(t, out, "last of old", "first of new")
+
+	appendFile(t, path, "more\n")
+	expectLines(t, out, "more")
+}
+
+func TestTailWaitsForMissingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "latest.log")
+
+	out := startTail(t, path)
+	appendFile(t, path, "created\n")
+	expectLines(t, out, "created")
+}
+
+func TestTailPollsUnwatchableDirectory(t *testing.T) {
+	interval := tailPollOnlyInterval
+	tailPollOnlyInterval = 50 * time.Millisecond
+	t.Cleanup(func() { tailPollOnlyInterval = interval })
+
+	// the directory doesn't exist yet, so it can't be watched
+	dir := filepath.Join(t.TempDir(), "logs")
+	path := filepath.Join(dir, "latest.log")
+
+	out := startTail(t, path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, path, "polled\n")
+	expectLines(t, out, "polled")
+}
@@ -2,53 +2,88 @@ package otp
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/vnxcius/mcpanel-back/internal/logging"
 )
 
+/*
+OTP is a one-time ticket for opening an authenticated websocket. It carries
+the actor and token of the session that asked for it; Session is empty for
+the bot.
+*/
 type OTP struct {
-	Key     string
-	Created time.Time
+	Key     string        `json:"otp"`
+	Created time.Time     `json:"-"`
+	Expires time.Time     `json:"expiresAt"`
+	Actor   logging.Actor `json:"-"`
+	Session string        `json:"-"`
 }
 
-type RetentionMap map[string]OTP
+type RetentionMap struct {
+	mu     sync.Mutex
+	otps   map[string]OTP
+	maxAge time.Duration
+}
 
-func NewRetentionMap(c context.Context, maxAge time.Duration) RetentionMap {
-	rm := make(RetentionMap)
-	go rm.Retention(c, maxAge)
+func NewRetentionMap(c context.Context, maxAge time.Duration) *RetentionMap {
+	rm := &RetentionMap{
+		otps:   make(map[string]OTP),
+		maxAge: maxAge,
+	}
+	go rm.Retention(c)
 	return rm
 }
 
-func (rm RetentionMap) Add() OTP {
+func (rm *RetentionMap) Add(actor logging.Actor, session string) OTP {
+	now := time.Now()
 	o := OTP{
 		Key:     uuid.NewString(),
-		Created: time.Now(),
+		Created: now,
+		Expires: now.Add(rm.maxAge),
+		Actor:   actor,
+		Session: session,
 	}
 
-	rm[o.Key] = o
+	rm.mu.Lock()
+	rm.otps[o.Key] = o
+	rm.mu.Unlock()
 	return o
 }
 
-func (rm RetentionMap) VerifyOTP(otp string) bool {
-	if _, ok := rm[otp]; !ok {
-		return false
+/*
+Consumes a ticket. Returns false if it doesn't exist, was already used or
+has expired.
+*/
+func (rm *RetentionMap) VerifyOTP(key string) (OTP, bool) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	o, ok := rm.otps[key]
+	if !ok {
+		return OTP{}, false
 	}
-	delete(rm, otp)
-	return true
+	delete(rm.otps, key)
+	return o, time.Now().Before(o.Expires)
 }
 
-func (rm RetentionMap) Retention(c context.Context, maxAge time.Duration) {
+func (rm *RetentionMap) Retention(c context.Context) {
 	ticker := time.NewTicker(400 * time.Millisecond)
+	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
-			for _, otp := range rm {
-				if otp.Created.Add(maxAge).Before(time.Now()) {
-					delete(rm, otp.Key)
+			now := time.Now()
+			rm.mu.Lock()
+			for key, otp := range rm.otps {
+				if !now.Before(otp.Expires) {
+					delete(rm.otps, key)
 				}
 			}
+			rm.mu.Unlock()
 		case <-c.Done():
 			return
 		}
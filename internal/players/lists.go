@@ -0,0 +1,316 @@
+package players
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vnxcius/mcpanel-back/internal/rcon"
+	"github.com/vnxcius/mcpanel-back/internal/utils"
+)
+
+type List string
+
+const (
+	Whitelist     List = "whitelist"
+	Ops           List = "ops"
+	BannedPlayers List = "banned-players"
+	BannedIPs     List = "banned-ips"
+)
+
+const (
+	ViaRcon = "rcon"
+	ViaFile = "file"
+
+	banDateLayout = "2006-01-02 15:04:05 -0700"
+	banSource     = "mcpanel"
+)
+
+type Change struct {
+	Name   string `json:"name"`
+	IP     string `json:"ip"`
+	Reason string `json:"reason"`
+	Level  int    `json:"level"`
+}
+
+type Result struct {
+	Name  string `json:"name,omitempty"`
+	UUID  string `json:"uuid,omitempty"`
+	IP    string `json:"ip,omitempty"`
+	Via   string `json:"via"`
+	Reply string `json:"reply,omitempty"`
+}
+
+/*
+Lists edits the server's whitelist, ops and ban files. While the server is
+online changes go through RCON so they take effect immediately and the
+server rewrites the files itself. While it is offline the files are edited
+directly.
+*/
+type Lists struct {
+	mu        sync.Mutex
+	serverDir string
+	status    func() string
+}
+
+var (
+	ErrInvalidList   = errors.New("invalid list")
+	ErrInvalidPlayer = errors.New("invalid player name")
+	ErrInvalidIP     = errors.New("invalid ip address")
+	ErrNotListed     = errors.New("entry not found in list")
+	ErrServerBusy    = errors.New("server is changing state, try again later")
+
+	playerName = regexp.MustCompile(`^[A-Za-z0-9_]{1,16}$`)
+)
+
+func NewLists(serverDir string, status func() string) *Lists {
+	return &Lists{serverDir: serverDir, status: status}
+}
+
+func (l List) IsValid() bool {
+	return l == Whitelist || l == Ops || l == BannedPlayers || l == BannedIPs
+}
+
+/*
+Returns the raw entries of a list file. Unknown fields are kept as is.
+*/
+func (l *Lists) Get(list List) ([]map[string]any, error) {
+	if !list.IsValid() {
+		return nil, ErrInvalidList
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.read(list)
+}
+
+func (l *Lists) Add(list List, change Change) (Result, error) {
+	if !list.IsValid() {
+		return Result{}, ErrInvalidList
+	}
+
+	target, err := validateTarget(list, change.Name, change.IP)
+	if err != nil {
+		return Result{}, err
+	}
+	reason := strings.Join(strings.Fields(change.Reason), " ")
+
+	var command string
+	switch list {
+	case Whitelist:
+		command = "whitelist add " + target
+	case Ops:
+		command = "op " + target
+	case BannedPlayers:
+		command = strings.TrimSpace("ban " + target + " " + reason)
+	case BannedIPs:
+		command = strings.TrimSpace("ban-ip " + target + " " + reason)
+	}
+
+	return l.apply(list, target, command, true, func(entries []map[string]any, result Result) ([]map[string]any, error) {
+		entries = removeEntry(list, entries, result)
+		return append(entries, newEntry(list, result, change.Level, reason)), nil
+	})
+}
+
+func (l *Lists) Remove(list List, target string) (Result, error) {
+	if !list.IsValid() {
+		return Result{}, ErrInvalidList
+	}
+
+	var name, ip string
+	if list == BannedIPs {
+		ip = target
+	} else {
+		name = target
+	}
+	target, err := validateTarget(list, name, ip)
+	if err != nil {
+		return Result{}, err
+	}
+
+	var command string
+	switch list {
+	case Whitelist:
+		command = "whitelist remove " + target
+	case Ops:
+		command = "deop " + target
+	case BannedPlayers:
+		command = "pardon " + target
+	case BannedIPs:
+		command = "pardon-ip " + target
+	}
+
+	return l.apply(list, target, command, false, func(entries []map[string]any, result Result) ([]map[string]any, error) {
+		remaining := removeEntry(list, entries, result)
+		if len(remaining) == len(entries) {
+			return nil, ErrNotListed
+		}
+		return remaining, nil
+	})
+}
+
+/*
+Runs command over RCON when the server is online, otherwise rewrites the
+list file with edit. needUUID tells whether the file entry needs the
+player's UUID; removals also match by name, and the server resolves
+players itself when online.
+*/
+func (l *Lists) apply(
+	list List,
+	target string,
+	command string,
+	needUUID bool,
+	edit func([]map[string]any, Result) ([]map[string]any, error),
+) (Result, error) {
+	result := Result{}
+	var resolveErr error
+	if list == BannedIPs {
+		result.IP = target
+	} else {
+		result.Name = target
+		if id, name, err := l.ResolveUUID(target); err == nil {
+			result.UUID, result.Name = id, name
+		} else {
+			resolveErr = err
+		}
+	}
+
+	switch l.status() {
+	case "online":
+		reply, err := rcon.Command(command)
+		if err != nil {
+			return Result{}, fmt.Errorf("running %q over rcon: %w", strings.Fields(command)[0], err)
+		}
+		result.Via = ViaRcon
+		result.Reply = reply
+		return result, nil
+	case "offline":
+		if needUUID && resolveErr != nil {
+			return Result{}, resolveErr
+		}
+
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		entries, err := l.read(list)
+		if err != nil {
+			return Result{}, err
+		}
+		entries, err = edit(entries, result)
+		if err != nil {
+			return Result{}, err
+		}
+		if err := l.write(list, entries); err != nil {
+			return Result{}, err
+		}
+		result.Via = ViaFile
+		return result, nil
+	default:
+		return Result{}, ErrServerBusy
+	}
+}
+
+func validateTarget(list List, name, ip string) (string, error) {
+	if list == BannedIPs {
+		if net.ParseIP(ip) == nil {
+			return "", ErrInvalidIP
+		}
+		return ip, nil
+	}
+
+	if !playerName.MatchString(name) {
+		return "", ErrInvalidPlayer
+	}
+	return name, nil
+}
+
+func newEntry(list List, r Result, level int, reason string) map[string]any {
+	now := time.Now().Format(banDateLayout)
+	if reason == "" {
+		reason = "Banned by an operator."
+	}
+
+	switch list {
+	case Ops:
+		if level < 1 || level > 4 {
+			level = 4
+		}
+		return map[string]any{
+			"uuid":                r.UUID,
+			"name":                r.Name,
+			"level":               level,
+			"bypassesPlayerLimit": false,
+		}
+	case BannedPlayers:
+		return map[string]any{
+			"uuid":    r.UUID,
+			"name":    r.Name,
+			"created": now,
+			"source":  banSource,
+			"expires": "forever",
+			"reason":  reason,
+		}
+	case BannedIPs:
+		return map[string]any{
+			"ip":      r.IP,
+			"created": now,
+			"source":  banSource,
+			"expires": "forever",
+			"reason":  reason,
+		}
+	default:
+		return map[string]any{"uuid": r.UUID, "name": r.Name}
+	}
+}
+
+func removeEntry(list List, entries []map[string]any, r Result) []map[string]any {
+	kept := make([]map[string]any, 0, len(entries))
+	for _, e := range entries {
+		if list == BannedIPs {
+			if e["ip"] == r.IP {
+				continue
+			}
+		} else {
+			name, _ := e["name"].(string)
+			id, _ := e["uuid"].(string)
+			if strings.EqualFold(name, r.Name) || strings.EqualFold(id, r.UUID) {
+				continue
+			}
+		}
+		kept = append(kept, e)
+	}
+	return kept
+}
+
+func (l *Lists) read(list List) ([]map[string]any, error) {
+	entries := []map[string]any{}
+
+	data, err := os.ReadFile(filepath.Join(l.serverDir, string(list)+".json"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return entries, nil
+		}
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("parsing %s.json: %w", list, err)
+	}
+	return entries, nil
+}
+
+func (l *Lists) write(list List, entries []map[string]any) error {
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(filepath.Join(l.serverDir, string(list)+".json"), data)
+}
@@ -0,0 +1,124 @@
+package players
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/vnxcius/mcpanel-back/internal/db"
+)
+
+type Session struct {
+	ID       int64      `json:"id"`
+	UUID     string     `json:"uuid"`
+	Name     string     `json:"name"`
+	IP       string     `json:"ip,omitempty"`
+	JoinedAt time.Time  `json:"joinedAt"`
+	LeftAt   *time.Time `json:"leftAt"`
+}
+
+type Playtime struct {
+	UUID     string    `json:"uuid"`
+	Name     string    `json:"name"`
+	Sessions int       `json:"sessions"`
+	Seconds  int64     `json:"playtimeSeconds"`
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+func openSession(p Player) (int64, error) {
+	var id int64
+	err := db.DBConn.QueryRow(
+		`INSERT INTO "PlayerSession" (uuid, name, ip, joined_at) VALUES ($1, $2, $3, $4) RETURNING id`,
+		p.UUID, p.Name, p.IP, p.JoinedAt,
+	).Scan(&id)
+	return id, err
+}
+
+func closeSession(id int64, at time.Time) error {
+	_, err := db.DBConn.Exec(
+		`UPDATE "PlayerSession" SET left_at = $1 WHERE id = $2 AND left_at IS NULL`,
+		at, id,
+	)
+	return err
+}
+
+func closeOpenSessions(at time.Time) error {
+	_, err := db.DBConn.Exec(
+		`UPDATE "PlayerSession" SET left_at = GREATEST(joined_at, $1) WHERE left_at IS NULL`,
+		at,
+	)
+	return err
+}
+
+func openSessions() ([]Session, error) {
+	rows, err := db.DBConn.Query(
+		`SELECT id, uuid, name, ip, joined_at, left_at FROM "PlayerSession" WHERE left_at IS NULL`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanSessions(rows)
+}
+
+/*
+Returns the most recent sessions, optionally only those of one player.
+*/
+func Sessions(name string, limit int) ([]Session, error) {
+	rows, err := db.DBConn.Query(
+		`SELECT id, uuid, name, ip, joined_at, left_at FROM "PlayerSession"
+		WHERE $1 = '' OR lower(name) = lower($1)
+		ORDER BY joined_at DESC LIMIT $2`,
+		name, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanSessions(rows)
+}
+
+/*
+Returns the total playtime and last-seen time of every player that ever
+joined. Players are grouped by UUID when the log told us one, by name
+otherwise. Open sessions count up to now.
+*/
+func Playtimes() ([]Playtime, error) {
+	rows, err := db.DBConn.Query(`
+		SELECT
+			max(uuid),
+			(array_agg(name ORDER BY joined_at DESC))[1],
+			count(*),
+			sum(extract(epoch FROM coalesce(left_at, now()) - joined_at))::bigint,
+			max(coalesce(left_at, now()))
+		FROM "PlayerSession"
+		GROUP BY coalesce(nullif(uuid, ''), lower(name))
+		ORDER BY 5 DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	playtimes := []Playtime{}
+	for rows.Next() {
+		var p Playtime
+		if err := rows.Scan(&p.UUID, &p.Name, &p.Sessions, &p.Seconds, &p.LastSeen); err != nil {
+			return nil, err
+		}
+		playtimes = append(playtimes, p)
+	}
+	return playtimes, rows.Err()
+}
+
+func scanSessions(rows *sql.Rows) ([]Session, error) {
+	sessions := []Session{}
+	for rows.Next() {
+		var s Session
+		if err := rows.Scan(&s.ID, &s.UUID, &s.Name, &s.IP, &s.JoinedAt, &s.LeftAt); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
@@ -0,0 +1,312 @@
+package players
+
+import (
+	"log/slog"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Player struct {
+	UUID     string    `json:"uuid,omitempty"`
+	Name     string    `json:"name"`
+	IP       string    `json:"ip,omitempty"`
+	JoinedAt time.Time `json:"joinedAt"`
+
+	// only touched by the session writer
+	session *playerSession
+}
+
+// Row of a player's session in the database, once it is stored
+type playerSession struct {
+	id int64
+}
+
+type EventType string
+
+const (
+	Joined EventType = "joined"
+	Left   EventType = "left"
+)
+
+type Event struct {
+	Type EventType `json:"type"`
+	UUID string    `json:"uuid,omitempty"`
+	Name string    `json:"name"`
+	IP   string    `json:"ip,omitempty"`
+	Time time.Time `json:"time"`
+}
+
+/*
+Tracker follows the server log and keeps the set of online players.
+Vanilla logs the UUID and address of a player a few lines before the
+"joined the game" line, so those are held until the join happens. Sessions
+are stored by a writer goroutine, in order, so a slow database never holds
+up the log.
+*/
+type Tracker struct {
+	mu        sync.Mutex
+	online    map[string]*Player
+	pending   map[string]*Player
+	recordIPs bool
+	// session writes made under mu, sent once it is released
+	queued []func()
+
+	// held while sending to writes, so they keep their order
+	sendMu sync.Mutex
+	writes chan func()
+}
+
+// session writes waiting for the database before HandleLine blocks
+const sessionQueueSize = 1024
+
+var (
+	timestampPattern = regexp.MustCompile(`^\[(\d{2}):(\d{2}):(\d{2})`)
+	uuidPattern      = regexp.MustCompile(`^UUID of player (\w{1,16}) is ([0-9a-fA-F-]{36})$`)
+	loginPattern     = regexp.MustCompile(`^(\w{1,16})\[/(.+):\d+\] logged in with entity id`)
+	joinPattern      = regexp.MustCompile(`^(\w{1,16})(?: \(formerly known as \w{1,16}\))? joined the game$`)
+	leavePattern     = regexp.MustCompile(`^(\w{1,16}) left the game$`)
+)
+
+/*
+Creates a tracker. When recordIPs is false player addresses are never
+stored or reported.
+*/
+func NewTracker(recordIPs bool) *Tracker {
+	t := &Tracker{
+		online:    make(map[string]*Player),
+		pending:   make(map[string]*Player),
+		recordIPs: recordIPs,
+		writes:    make(chan func(), sessionQueueSize),
+	}
+	go t.writeSessions()
+	return t
+}
+
+func (t *Tracker) writeSessions() {
+	for write := range t.writes {
+		write()
+	}
+}
+
+/*
+Releases mu and hands the writes queued under it to the writer. With the
+database stalled the channel fills up; only the caller waits then, readers
+like Online can still take mu.
+*/
+func (t *Tracker) unlockAndSend() {
+	queued := t.queued
+	t.queued = nil
+
+	t.sendMu.Lock()
+	defer t.sendMu.Unlock()
+	t.mu.Unlock()
+
+	for _, write := range queued {
+		t.writes <- write
+	}
+}
+
+/*
+Restores the online set after a panel restart. If the server is still
+online the sessions left open in the database carry on, otherwise they are
+closed now.
+*/
+func (t *Tracker) Resume(serverOnline bool) {
+	if !serverOnline {
+		t.Reset(time.Now())
+		return
+	}
+
+	sessions, err := openSessions()
+	if err != nil {
+		slog.Error("Failed to load open player sessions", "error", err)
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, s := range sessions {
+		t.online[strings.ToLower(s.Name)] = &Player{
+			UUID:     s.UUID,
+			Name:     s.Name,
+			IP:       s.IP,
+			JoinedAt: s.JoinedAt,
+			session:  &playerSession{id: s.ID},
+		}
+	}
+}
+
+/*
+Feeds a raw log line to the tracker. Returns the join or leave event the
+line produced, if any.
+*/
+func (t *Tracker) HandleLine(line string) (Event, bool) {
+	msg, ok := logMessage(line)
+	if !ok {
+		return Event{}, false
+	}
+
+	t.mu.Lock()
+	defer t.unlockAndSend()
+
+	if m := uuidPattern.FindStringSubmatch(msg); m != nil {
+		t.pendingPlayer(m[1]).UUID = strings.ToLower(m[2])
+		return Event{}, false
+	}
+
+	if m := loginPattern.FindStringSubmatch(msg); m != nil {
+		if t.recordIPs {
+			t.pendingPlayer(m[1]).IP = strings.Trim(m[2], "[]")
+		}
+		return Event{}, false
+	}
+
+	if m := joinPattern.FindStringSubmatch(msg); m != nil {
+		return t.join(m[1], lineTime(line)), true
+	}
+
+	if m := leavePattern.FindStringSubmatch(msg); m != nil {
+		return t.leave(m[1], lineTime(line))
+	}
+
+	return Event{}, false
+}
+
+/*
+Returns the players currently online, sorted by name.
+*/
+func (t *Tracker) Online() []Player {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	players := make([]Player, 0, len(t.online))
+	for _, p := range t.online {
+		players = append(players, *p)
+	}
+	sort.Slice(players, func(i, j int) bool {
+		return strings.ToLower(players[i].Name) < strings.ToLower(players[j].Name)
+	})
+	return players
+}
+
+/*
+Closes every open session. Called when the server goes offline, since a
+crash never logs the players leaving.
+*/
+func (t *Tracker) Reset(at time.Time) {
+	t.mu.Lock()
+	defer t.unlockAndSend()
+
+	t.online = make(map[string]*Player)
+	t.pending = make(map[string]*Player)
+	t.queued = append(t.queued, func() {
+		if err := closeOpenSessions(at); err != nil {
+			slog.Error("Failed to close player sessions", "error", err)
+		}
+	})
+}
+
+func (t *Tracker) join(name string, at time.Time) Event {
+	key := strings.ToLower(name)
+
+	p := t.pending[key]
+	if p == nil {
+		p = &Player{}
+	}
+	delete(t.pending, key)
+
+	p.Name = name
+	p.JoinedAt = at
+
+	if previous, ok := t.online[key]; ok {
+		// missed the leave line, don't leave the old session open forever
+		t.closeSession(previous, at)
+	}
+
+	p.session = &playerSession{}
+	t.online[key] = p
+
+	row, session := *p, p.session
+	t.queued = append(t.queued, func() {
+		id, err := openSession(row)
+		if err != nil {
+			slog.Error("Failed to store player session", "player", row.Name, "error", err)
+		}
+		session.id = id
+	})
+
+	return Event{Type: Joined, UUID: p.UUID, Name: p.Name, IP: p.IP, Time: at}
+}
+
+func (t *Tracker) leave(name string, at time.Time) (Event, bool) {
+	key := strings.ToLower(name)
+
+	p, ok := t.online[key]
+	if !ok {
+		return Event{Type: Left, Name: name, Time: at}, true
+	}
+	delete(t.online, key)
+	t.closeSession(p, at)
+
+	return Event{Type: Left, UUID: p.UUID, Name: p.Name, IP: p.IP, Time: at}, true
+}
+
+func (t *Tracker) closeSession(p *Player, at time.Time) {
+	session, name := p.session, p.Name
+	if session == nil {
+		return
+	}
+	t.queued = append(t.queued, func() {
+		if err := closeSession(session.id, at); err != nil {
+			slog.Error("Failed to close player session", "player", name, "error", err)
+		}
+	})
+}
+
+func (t *Tracker) pendingPlayer(name string) *Player {
+	key := strings.ToLower(name)
+	if p, ok := t.pending[key]; ok {
+		return p
+	}
+	p := &Player{Name: name}
+	t.pending[key] = p
+	return p
+}
+
+/*
+Returns the message part of a Log4j line, after the "[time] [thread/LEVEL]"
+header and the optional "[logger]" that Forge adds.
+*/
+func logMessage(line string) (string, bool) {
+	idx := strings.Index(line, "]: ")
+	if idx < 0 {
+		return "", false
+	}
+	return strings.TrimSpace(line[idx+3:]), true
+}
+
+/*
+Log lines only carry the time of day, so it is placed on the current day,
+or on the previous one if that would put it in the future.
+*/
+func lineTime(line string) time.Time {
+	now := time.Now()
+	m := timestampPattern.FindStringSubmatch(line)
+	if m == nil {
+		return now
+	}
+
+	t, err := time.ParseInLocation("15:04:05", m[1]+":"+m[2]+":"+m[3], time.Local)
+	if err != nil {
+		return now
+	}
+
+	at := time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.Local)
+	if at.After(now.Add(time.Minute)) {
+		at = at.AddDate(0, 0, -1)
+	}
+	return at
+}
@@ -0,0 +1,108 @@
+package players
+
+import (
+	"testing"
+	"time"
+)
+
+/*
+Builds a tracker whose writer never runs, so the session queue fills up
+like it does while the database is stalled.
+*/
+func newStalledTracker(queueSize int) *Tracker {
+	return &Tracker{
+		online:  make(map[string]*Player),
+		pending: make(map[string]*Player),
+		writes:  make(chan func(), queueSize),
+	}
+}
+
+func TestHandleLine(t *testing.T) {
+	tr := newStalledTracker(10)
+	tr.recordIPs = true
+
+	lines := []string{
+		"[12:00:00] [User Authenticator #1/INFO]: UUID of player Steve is 069a79f4-44e9-4726-a5be-fca90e38aaf5",
+		"[12:00:01] [Server thread/INFO]: Steve[/127.0.0.1:51234] logged in with entity id 123 at (0.5, 64.0, 0.5)",
+	}
+	for _, line := range lines {
+		if _, ok := tr.HandleLine(line); ok {
+			t.Fatalf("%q produced an event", line)
+		}
+	}
+
+	event, ok := tr.HandleLine("[12:00:01] [Server thread/INFO]: Steve joined the game")
+	if !ok || event.Type != Joined || event.Name != "Steve" || event.UUID != "069a79f4-44e9-4726-a5be-fca90e38aaf5" || event.IP != "127.0.0.1" {
+		t.Fatalf("got join %+v, %v", event, ok)
+	}
+	if online := tr.Online(); len(online) != 1 || online[0].Name != "Steve" {
+		t.Fatalf("online %+v", online)
+	}
+
+	event, ok = tr.HandleLine("[12:05:00] [Server thread/INFO]: [Not Secure] <Alex> Steve left the game")
+	if ok {
+		t.Fatalf("chat produced %+v", event)
+	}
+
+	event, ok = tr.HandleLine("[12:05:00] [Server thread/INFO]: Steve left the game")
+	if !ok || event.Type != Left || event.Name != "Steve" {
+		t.Fatalf("got leave %+v, %v", event, ok)
+	}
+	if online := tr.Online(); len(online) != 0 {
+		t.Fatalf("online %+v", online)
+	}
+
+	// the session was opened and closed
+	if n := len(tr.writes); n != 2 {
+		t.Fatalf("queued %d session writes, want 2", n)
+	}
+}
+
+func TestStalledWriterDoesNotHoldTheLock(t *testing.T) {
+	tr := newStalledTracker(1)
+
+	tr.HandleLine("[12:00:00] [Server thread/INFO]: Steve joined the game")
+
+	// the queue is full, so this join waits for the writer
+	done := make(chan struct{})
+	go func() {
+		tr.HandleLine("[12:00:01] [Server thread/INFO]: Alex joined the game")
+		tr.Reset(time.Now())
+		close(done)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case <-done:
+		t.Fatal("HandleLine returned with a full queue")
+	default:
+	}
+
+	online := make(chan []Player)
+	go func() { online <- tr.Online() }()
+	select {
+	case players := <-online:
+		if len(players) != 2 {
+			t.Fatalf("online %+v, want both players", players)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Online blocked on the stalled writer")
+	}
+
+	// draining the queue lets the join and the reset through, in order
+	for range 3 {
+		select {
+		case <-tr.writes:
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for a queued write")
+		}
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("HandleLine still blocked after the queue drained")
+	}
+	if players := tr.Online(); len(players) != 0 {
+		t.Fatalf("online %+v after reset", players)
+	}
+}
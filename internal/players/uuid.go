@@ -0,0 +1,108 @@
+package players
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vnxcius/mcpanel-back/internal/properties"
+)
+
+type cachedUser struct {
+	Name string `json:"name"`
+	UUID string `json:"uuid"`
+}
+
+var (
+	ErrUnknownPlayer = errors.New("no Minecraft account with that name")
+	ErrLookupFailed  = errors.New("could not look up the player's UUID")
+
+	mojangClient     = &http.Client{Timeout: 5 * time.Second}
+	mojangProfileURL = "https://api.mojang.com/users/profiles/minecraft/"
+)
+
+/*
+Returns the UUID the server would use for an offline-mode player, which is
+what Java's UUID.nameUUIDFromBytes gives for "OfflinePlayer:<name>".
+*/
+func OfflineUUID(name string) string {
+	sum := md5.Sum([]byte("OfflinePlayer:" + name))
+	sum[6] = (sum[6] & 0x0f) | 0x30 // version 3
+	sum[8] = (sum[8] & 0x3f) | 0x80 // IETF variant
+	return uuid.UUID(sum).String()
+}
+
+/*
+Resolves a player name to a UUID using the server's usercache.json. Players
+that never joined get the offline-mode UUID on servers with
+online-mode=false and their Mojang account's UUID otherwise. Returns the
+name with the casing the server or Mojang knows it by.
+*/
+func (l *Lists) ResolveUUID(name string) (string, string, error) {
+	data, err := os.ReadFile(filepath.Join(l.serverDir, "usercache.json"))
+	if err == nil {
+		var users []cachedUser
+		if err := json.Unmarshal(data, &users); err == nil {
+			for _, u := range users {
+				if strings.EqualFold(u.Name, name) {
+					return u.UUID, u.Name, nil
+				}
+			}
+		}
+	}
+
+	if !l.onlineMode() {
+		return OfflineUUID(name), name, nil
+	}
+	return mojangUUID(name)
+}
+
+// Minecraft defaults to online mode when the key is missing
+func (l *Lists) onlineMode() bool {
+	data, err := os.ReadFile(filepath.Join(l.serverDir, "server.properties"))
+	if err != nil {
+		return true
+	}
+	f, err := properties.Parse(data)
+	if err != nil {
+		return true
+	}
+	value, ok := f.Get("online-mode")
+	return !ok || strings.TrimSpace(value) != "false"
+}
+
+func mojangUUID(name string) (string, string, error) {
+	resp, err := mojangClient.Get(mojangProfileURL + name)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %v", ErrLookupFailed, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNoContent, http.StatusNotFound:
+		return "", "", ErrUnknownPlayer
+	default:
+		return "", "", fmt.Errorf("%w: mojang answered %s", ErrLookupFailed, resp.Status)
+	}
+
+	var profile struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&profile); err != nil {
+		return "", "", fmt.Errorf("%w: %v", ErrLookupFailed, err)
+	}
+	id, err := uuid.Parse(profile.ID)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %v", ErrLookupFailed, err)
+	}
+	return id.String(), profile.Name, nil
+}
@@ -0,0 +1,268 @@
+package properties
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/*
+line is a comment, blank line or entry as written in the file. raw spans
+the continuation lines of an entry, eol is the line ending after it, empty
+for a last line without one.
+*/
+type line struct {
+	raw     string
+	eol     string
+	key     string
+	value   string
+	isEntry bool
+}
+
+/*
+File is a parsed Java .properties file. Comments, blank lines, line endings
+and the order of keys are kept so the file can be written back without
+reformatting it.
+*/
+type File struct {
+	lines []line
+	// ending of the file's first line, used for lines added by Set
+	newline string
+}
+
+type physicalLine struct {
+	text string
+	eol  string
+}
+
+func splitLines(s string) []physicalLine {
+	var lines []physicalLine
+	for s != "" {
+		end := strings.IndexByte(s, '\n')
+		if end < 0 {
+			lines = append(lines, physicalLine{text: s})
+			break
+		}
+
+		l := physicalLine{text: s[:end], eol: "\n"}
+		if strings.HasSuffix(l.text, "\r") {
+			l.text, l.eol = l.text[:len(l.text)-1], "\r\n"
+		}
+		lines = append(lines, l)
+		s = s[end+1:]
+	}
+	return lines
+}
+
+/*
+Parses a .properties file. Returns an error on malformed escape sequences,
+which is the only thing the format really rejects.
+*/
+func Parse(data []byte) (*File, error) {
+	physical := splitLines(string(data))
+
+	f := &File{newline: "\n"}
+	if len(physical) > 0 && physical[0].eol != "" {
+		f.newline = physical[0].eol
+	}
+
+	for i := 0; i < len(physical); i++ {
+		start := i
+		raw, eol := physical[i].text, physical[i].eol
+		trimmed := strings.TrimLeft(raw, " \t\f")
+
+		if trimmed == "" || trimmed[0] == '#' || trimmed[0] == '!' {
+			f.lines = append(f.lines, line{raw: raw, eol: eol})
+			continue
+		}
+
+		// join continuation lines
+		logical := trimmed
+		for endsWithContinuation(logical) && i+1 < len(physical) {
+			i++
+			raw += eol + physical[i].text
+			eol = physical[i].eol
+			logical = logical[:len(logical)-1] + strings.TrimLeft(physical[i].text, " \t\f")
+		}
+		if endsWithContinuation(logical) {
+			logical = logical[:len(logical)-1]
+		}
+
+		key, value, err := splitEntry(logical)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", start+1, err)
+		}
+
+		f.lines = append(f.lines, line{raw: raw, eol: eol, key: key, value: value, isEntry: true})
+	}
+
+	return f, nil
+}
+
+func endsWithContinuation(s string) bool {
+	backslashes := 0
+	for i := len(s) - 1; i >= 0 && s[i] == '\\'; i-- {
+		backslashes++
+	}
+	return backslashes%2 == 1
+}
+
+func splitEntry(s string) (string, string, error) {
+	sep := len(s)
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' {
+			i++
+			continue
+		}
+		if s[i] == '=' || s[i] == ':' || s[i] == ' ' || s[i] == '\t' || s[i] == '\f' {
+			sep = i
+			break
+		}
+	}
+
+	key, err := unescape(s[:sep])
+	if err != nil {
+		return "", "", err
+	}
+
+	rest := strings.TrimLeft(s[sep:], " \t\f")
+	if rest != "" && (rest[0] == '=' || rest[0] == ':') {
+		rest = strings.TrimLeft(rest[1:], " \t\f")
+	}
+
+	value, err := unescape(rest)
+	if err != nil {
+		return "", "", err
+	}
+
+	return key, value, nil
+}
+
+func unescape(s string) (string, error) {
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		if i >= len(s) {
+			break
+		}
+		switch s[i] {
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 'f':
+			b.WriteByte('\f')
+		case 'u':
+			if len(s[i+1:]) < 4 {
+				return "", fmt.Errorf("malformed \\u escape")
+			}
+			r, err := strconv.ParseUint(s[i+1:i+5], 16, 32)
+			if err != nil {
+				return "", fmt.Errorf("malformed \\u escape %q", s[i-1:i+5])
+			}
+			b.WriteRune(rune(r))
+			i += 4
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String(), nil
+}
+
+func escape(s string, isKey bool) string {
+	var b strings.Builder
+	for i, r := range s {
+		switch r {
+		case '\\':
+			b.WriteString(`\\`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '=', ':', '#', '!':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case ' ':
+			if isKey || i == 0 {
+				b.WriteByte('\\')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+/*
+Returns the value of key and whether it was present.
+*/
+func (f *File) Get(key string) (string, bool) {
+	for _, l := range f.lines {
+		if l.isEntry && l.key == key {
+			return l.value, true
+		}
+	}
+	return "", false
+}
+
+/*
+Sets key to value. Existing entries are rewritten in place, new keys are
+appended at the end of the file.
+*/
+func (f *File) Set(key, value string) {
+	raw := escape(key, true) + "=" + escape(value, false)
+	for i, l := range f.lines {
+		if l.isEntry && l.key == key {
+			if l.value != value {
+				f.lines[i] = line{raw: raw, eol: l.eol, key: key, value: value, isEntry: true}
+			}
+			return
+		}
+	}
+
+	if n := len(f.lines); n > 0 && f.lines[n-1].eol == "" {
+		f.lines[n-1].eol = f.newline
+	}
+	f.lines = append(f.lines, line{raw: raw, eol: f.newline, key: key, value: value, isEntry: true})
+}
+
+/*
+Returns the keys in the order they appear in the file.
+*/
+func (f *File) Keys() []string {
+	keys := []string{}
+	for _, l := range f.lines {
+		if l.isEntry {
+			keys = append(keys, l.key)
+		}
+	}
+	return keys
+}
+
+/*
+Serialises the file back, keeping untouched lines byte for byte.
+*/
+func (f *File) Bytes() []byte {
+	var buf bytes.Buffer
+	for _, l := range f.lines {
+		buf.WriteString(l.raw)
+		buf.WriteString(l.eol)
+	}
+	return buf.Bytes()
+}
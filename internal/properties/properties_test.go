@@ -0,0 +1,155 @@
+package properties
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want map[string]string
+	}{
+		{
+			name: "separators",
+			data: "a=1\nb: 2\nc 3\nd\t=  4\n  e=5\nf=\n",
+			want: map[string]string{"a": "1", "b": "2", "c": "3", "d": "4", "e": "5", "f": ""},
+		},
+		{
+			name: "comments and blank lines",
+			data: "# a comment\n! another=one\n\n   \n  # indented=comment\nkey=value\n",
+			want: map[string]string{"key": "value"},
+		},
+		{
+			name: "continuations",
+			data: "motd=Hello \\\n    World\nnext=1\n",
+			want: map[string]string{"motd": "Hello World", "next": "1"},
+		},
+		{
+			name: "escaped backslash is not a continuation",
+			data: "path=C:\\\\\nnext=1\n",
+			want: map[string]string{"path": `C:\`, "next": "1"},
+		},
+		{
+			name: "continuation on the last line",
+			data: "motd=Hello\\",
+			want: map[string]string{"motd": "Hello"},
+		},
+		{
+			name: "escapes",
+			data: "key\\ with\\=seps=tab\\there\\nnewline\nunicode=caf\\u00e9\n\\#hash=\\!bang\n",
+			want: map[string]string{"key with=seps": "tab\there\nnewline", "unicode": "café", "#hash": "!bang"},
+		},
+		{
+			name: "crlf",
+			data: "a=1\r\nmotd=Hello \\\r\n  World\r\n",
+			want: map[string]string{"a": "1", "motd": "Hello World"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := Parse([]byte(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if keys := f.Keys(); len(keys) != len(tt.want) {
+				t.Fatalf("got keys %q, want %d", keys, len(tt.want))
+			}
+			for key, want := range tt.want {
+				if got, ok := f.Get(key); !ok || got != want {
+					t.Errorf("Get(%q) = %q, %v, want %q", key, got, ok, want)
+				}
+			}
+			if got := string(f.Bytes()); got != tt.data {
+				t.Errorf("round trip changed the file to %q", got)
+			}
+		})
+	}
+}
+
+func TestParseErrorsReportTheFirstLine(t *testing.T) {
+	_, err := Parse([]byte("a=1\nbad=one \\\n  two \\\n  \\u12\nc=3\n"))
+	if err == nil || !strings.HasPrefix(err.Error(), "line 2:") {
+		t.Fatalf("got %v, want an error on line 2", err)
+	}
+}
+
+func TestSet(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		key   string
+		value string
+		want  string
+	}{
+		{
+			name: "existing key",
+			data: "# settings\na=1\nb=2\n", key: "a", value: "10",
+			want: "# settings\na=10\nb=2\n",
+		},
+		{
+			name: "same value keeps the line",
+			data: "a : 1\n", key: "a", value: "1",
+			want: "a : 1\n",
+		},
+		{
+			name: "existing continued key",
+			data: "motd=Hello \\\n  World\nb=2\n", key: "motd", value: "Hi",
+			want: "motd=Hi\nb=2\n",
+		},
+		{
+			name: "new key",
+			data: "a=1\n", key: "b", value: "2",
+			want: "a=1\nb=2\n",
+		},
+		{
+			name: "new key without a final newline",
+			data: "a=1", key: "b", value: "2",
+			want: "a=1\nb=2\n",
+		},
+		{
+			name: "new key in an empty file",
+			data: "", key: "a", value: "1",
+			want: "a=1\n",
+		},
+		{
+			name: "existing key with crlf",
+			data: "a=1\r\nb=2\r\n", key: "a", value: "10",
+			want: "a=10\r\nb=2\r\n",
+		},
+		{
+			name: "new key with crlf",
+			data: "a=1\r\nb=2", key: "c", value: "3",
+			want: "a=1\r\nb=2\r\nc=3\r\n",
+		},
+		{
+			name: "escaped key and value",
+			data: "", key: "a key=", value: " lead\tC:\\",
+			want: "a\\ key\\==\\ lead\\tC\\:\\\\\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := Parse([]byte(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			f.Set(tt.key, tt.value)
+			if got := string(f.Bytes()); got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+
+			// what Set wrote reads back as the same value
+			reparsed, err := Parse(f.Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := reparsed.Get(tt.key); got != tt.value {
+				t.Fatalf("reparsed %q as %q, want %q", tt.key, got, tt.value)
+			}
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package properties
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+/*
+ServerProperties holds the settings of server.properties the panel exposes
+as form controls. The json tags are the property keys themselves.
+*/
+type ServerProperties struct {
+	Motd               string `json:"motd"`
+	Difficulty         string `json:"difficulty"`
+	Gamemode           string `json:"gamemode"`
+	ForceGamemode      bool   `json:"force-gamemode"`
+	Hardcore           bool   `json:"hardcore"`
+	PVP                bool   `json:"pvp"`
+	MaxPlayers         int    `json:"max-players"`
+	ViewDistance       int    `json:"view-distance"`
+	SimulationDistance int    `json:"simulation-distance"`
+	SpawnProtection    int    `json:"spawn-protection"`
+	AllowFlight        bool   `json:"allow-flight"`
+	AllowNether        bool   `json:"allow-nether"`
+	OnlineMode         bool   `json:"online-mode"`
+	WhiteList          bool   `json:"white-list"`
+	EnforceWhitelist   bool   `json:"enforce-whitelist"`
+	EnableCommandBlock bool   `json:"enable-command-block"`
+	OpPermissionLevel  int    `json:"op-permission-level"`
+	PlayerIdleTimeout  int    `json:"player-idle-timeout"`
+	LevelName          string `json:"level-name"`
+	LevelSeed          string `json:"level-seed"`
+	ServerPort         int    `json:"server-port"`
+	EnableRcon         bool   `json:"enable-rcon"`
+	RconPort           int    `json:"rcon.port"`
+}
+
+type intRange struct {
+	min, max int
+}
+
+var (
+	ErrUnknownKey = errors.New("unknown property")
+
+	// keys the panel never hands out or accepts
+	hiddenKeys = []string{"rcon.password"}
+
+	options = map[string][]string{
+		"difficulty": {"peaceful", "easy", "normal", "hard"},
+		"gamemode":   {"survival", "creative", "adventure", "spectator"},
+	}
+
+	ranges = map[string]intRange{
+		"max-players":         {0, 1000},
+		"view-distance":       {3, 32},
+		"simulation-distance": {3, 32},
+		"spawn-protection":    {0, 1 << 16},
+		"op-permission-level": {0, 4},
+		"player-idle-timeout": {0, 1 << 16},
+		"server-port":         {1, 65535},
+		"rcon.port":           {1, 65535},
+	}
+)
+
+/*
+InvalidValueError reports a property value that failed validation.
+*/
+type InvalidValueError struct {
+	Key    string
+	Reason string
+}
+
+func (e *InvalidValueError) Error() string {
+	return fmt.Sprintf("invalid value for %s: %s", e.Key, e.Reason)
+}
+
+/*
+Returns the typed settings found in the file. Missing or unparsable values
+keep the zero value. Every other visible key is returned as a string in
+others.
+*/
+func (f *File) Server() (ServerProperties, map[string]string) {
+	var sp ServerProperties
+	typed := reflect.ValueOf(&sp).Elem()
+
+	for i := 0; i < typed.NumField(); i++ {
+		key := fieldKey(typed.Type().Field(i))
+		raw, ok := f.Get(key)
+		if !ok {
+			continue
+		}
+
+		field := typed.Field(i)
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(raw)
+		case reflect.Bool:
+			field.SetBool(raw == "true")
+		case reflect.Int:
+			if n, err := strconv.Atoi(strings.TrimSpace(raw)); err == nil {
+				field.SetInt(int64(n))
+			}
+		}
+	}
+
+	others := map[string]string{}
+	for _, key := range f.Keys() {
+		if _, ok := typedField(key); ok || slices.Contains(hiddenKeys, key) {
+			continue
+		}
+		others[key], _ = f.Get(key)
+	}
+
+	return sp, others
+}
+
+/*
+Applies a set of changes sent by a client. Typed keys are decoded into
+their Go type and validated, other existing keys are accepted as strings.
+Nothing is modified unless every change is valid. Returns the keys whose
+value actually changed, in file order, then typed keys added to the file
+in declaration order.
+*/
+func (f *File) Update(changes map[string]json.RawMessage) ([]string, error) {
+	values := map[string]string{}
+
+	// sorted so the same request always fails on the same key
+	for _, key := range slices.Sorted(maps.Keys(changes)) {
+		value, err := decodeValue(f, key, changes[key])
+		if err != nil {
+			return nil, err
+		}
+		values[key] = value
+	}
+
+	changed := []string{}
+	for _, key := range f.Keys() {
+		value, ok := values[key]
+		if !ok {
+			continue
+		}
+		if current, _ := f.Get(key); current != value {
+			changed = append(changed, key)
+		}
+		f.Set(key, value)
+		delete(values, key)
+	}
+
+	// typed keys that were missing from the file
+	t := reflect.TypeOf(ServerProperties{})
+	for i := 0; i < t.NumField(); i++ {
+		key := fieldKey(t.Field(i))
+		if value, ok := values[key]; ok {
+			f.Set(key, value)
+			changed = append(changed, key)
+		}
+	}
+
+	return changed, nil
+}
+
+func decodeValue(f *File, key string, raw json.RawMessage) (string, error) {
+	if slices.Contains(hiddenKeys, key) {
+		return "", fmt.Errorf("%w: %s", ErrUnknownKey, key)
+	}
+
+	field, ok := typedField(key)
+	if !ok {
+		if _, exists := f.Get(key); !exists {
+			return "", fmt.Errorf("%w: %s", ErrUnknownKey, key)
+		}
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return "", &InvalidValueError{key, "expected a string"}
+		}
+		return s, nil
+	}
+
+	switch field.Type.Kind() {
+	case reflect.Bool:
+		var b bool
+		if err := json.Unmarshal(raw, &b); err != nil {
+			return "", &InvalidValueError{key, "expected a boolean"}
+		}
+		return strconv.FormatBool(b), nil
+	case reflect.Int:
+		var n int
+		if err := json.Unmarshal(raw, &n); err != nil {
+			return "", &InvalidValueError{key, "expected an integer"}
+		}
+		if r, ok := ranges[key]; ok && (n < r.min || n > r.max) {
+			return "", &InvalidValueError{key, fmt.Sprintf("must be between %d and %d", r.min, r.max)}
+		}
+		return strconv.Itoa(n), nil
+	default:
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return "", &InvalidValueError{key, "expected a string"}
+		}
+		if opts, ok := options[key]; ok && !slices.Contains(opts, s) {
+			return "", &InvalidValueError{key, "must be one of " + strings.Join(opts, ", ")}
+		}
+		if key == "level-name" && strings.TrimSpace(s) == "" {
+			return "", &InvalidValueError{key, "cannot be empty"}
+		}
+		return s, nil
+	}
+}
+
+func typedField(key string) (reflect.StructField, bool) {
+	t := reflect.TypeOf(ServerProperties{})
+	for i := 0; i < t.NumField(); i++ {
+		if fieldKey(t.Field(i)) == key {
+			return t.Field(i), true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+func fieldKey(f reflect.StructField) string {
+	return strings.Split(f.Tag.Get("json"), ",")[0]
+}
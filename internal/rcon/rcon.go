@@ -0,0 +1,174 @@
+package rcon
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	packetResponse int32 = 0
+	packetCommand  int32 = 2
+	packetAuth     int32 = 3
+
+	maxPacketSize = 4096 + 14
+	timeout       = 5 * time.Second
+)
+
+var (
+	ErrAuthFailed    = errors.New("rcon authentication failed")
+	ErrNotConfigured = errors.New("rcon is not configured")
+)
+
+/*
+Conn is a single authenticated RCON connection to the Minecraft server.
+It is safe for concurrent use, commands are sent one at a time.
+*/
+type Conn struct {
+	mu     sync.Mutex
+	conn   net.Conn
+	nextID int32
+}
+
+/*
+Dials the RCON port and authenticates with password.
+*/
+func Dial(addr, password string) (*Conn, error) {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Conn{conn: conn, nextID: 1}
+	id, err := c.write(packetAuth, password)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	respID, _, err := c.read()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if respID == -1 || respID != id {
+		conn.Close()
+		return nil, ErrAuthFailed
+	}
+
+	return c, nil
+}
+
+/*
+Sends a command and returns the server's reply. Long replies come split
+over several packets with no marker on the last one, so an empty packet is
+sent after the command: the server answers in order, once its reply to the
+empty packet arrives the whole reply has been read.
+*/
+func (c *Conn) Execute(command string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	id, err := c.write(packetCommand, command)
+	if err != nil {
+		return "", err
+	}
+	sentinel, err := c.write(packetResponse, "")
+	if err != nil {
+		return "", err
+	}
+
+	var reply strings.Builder
+	for {
+		respID, body, err := c.read()
+		if err != nil {
+			return "", err
+		}
+		switch respID {
+		case id:
+			reply.WriteString(body)
+		case sentinel:
+			return reply.String(), nil
+		default:
+			return "", fmt.Errorf("unexpected rcon response id %d", respID)
+		}
+	}
+}
+
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+/*
+Runs a single command using RCON_ADDR and RCON_PASSWORD from the
+environment, opening and closing a connection for it.
+*/
+func Command(command string) (string, error) {
+	password := os.Getenv("RCON_PASSWORD")
+	if password == "" {
+		return "", ErrNotConfigured
+	}
+
+	addr := os.Getenv("RCON_ADDR")
+	if addr == "" {
+		addr = "localhost:25575"
+	}
+
+	conn, err := Dial(addr, password)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	return conn.Execute(command)
+}
+
+func (c *Conn) write(packetType int32, body string) (int32, error) {
+	id := c.nextID
+	c.nextID++
+
+	var buf bytes.Buffer
+	length := int32(4 + 4 + len(body) + 2)
+	_ = binary.Write(&buf, binary.LittleEndian, length)
+	_ = binary.Write(&buf, binary.LittleEndian, id)
+	_ = binary.Write(&buf, binary.LittleEndian, packetType)
+	buf.WriteString(body)
+	buf.Write([]byte{0, 0})
+
+	if err := c.conn.SetWriteDeadline(time.Now().Add(timeout)); err != nil {
+		return 0, err
+	}
+	_, err := c.conn.Write(buf.Bytes())
+	return id, err
+}
+
+func (c *Conn) read() (int32, string, error) {
+	if err := c.conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return 0, "", err
+	}
+
+	var length int32
+	if err := binary.Read(c.conn, binary.LittleEndian, &length); err != nil {
+		return 0, "", err
+	}
+	if length < 10 || length > maxPacketSize {
+		return 0, "", fmt.Errorf("invalid rcon packet length %d", length)
+	}
+
+	packet := make([]byte, length)
+	if _, err := io.ReadFull(c.conn, packet); err != nil {
+		return 0, "", err
+	}
+
+	id := int32(binary.LittleEndian.Uint32(packet[0:4]))
+	body := bytes.TrimRight(packet[8:], "\x00")
+
+	return id, string(body), nil
+}
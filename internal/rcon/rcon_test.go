@@ -0,0 +1,154 @@
+package rcon
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+const testPassword = "hunter2"
+
+func writePacket(w io.Writer, id, packetType int32, body string) error {
+	var buf bytes.Buffer
+	_ = binary.Write(&buf, binary.LittleEndian, int32(4+4+len(body)+2))
+	_ = binary.Write(&buf, binary.LittleEndian, id)
+	_ = binary.Write(&buf, binary.LittleEndian, packetType)
+	buf.WriteString(body)
+	buf.Write([]byte{0, 0})
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func readPacket(r io.Reader) (int32, int32, string, error) {
+	var length int32
+	if err := binary.Read(r, binary.LittleEndian, &length); err != nil {
+		return 0, 0, "", err
+	}
+	packet := make([]byte, length)
+	if _, err := io.ReadFull(r, packet); err != nil {
+		return 0, 0, "", err
+	}
+	id := int32(binary.LittleEndian.Uint32(packet[0:4]))
+	packetType := int32(binary.LittleEndian.Uint32(packet[4:8]))
+	return id, packetType, string(bytes.TrimRight(packet[8:], "\x00")), nil
+}
+
+/*
+Starts a server that answers like Minecraft does: replies longer than 4096
+bytes are split over several packets and packets of an unknown type get
+"Unknown request" back.
+*/
+func newFakeServer(t *testing.T, replies map[string]string) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serve(conn, replies)
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+func serve(conn net.Conn, replies map[string]string) {
+	defer conn.Close()
+	for {
+		id, packetType, body, err := readPacket(conn)
+		if err != nil {
+			return
+		}
+
+		switch packetType {
+		case packetAuth:
+			if body != testPassword {
+				id = -1
+			}
+			_ = writePacket(conn, id, packetCommand, "")
+		case packetCommand:
+			reply := replies[body]
+			for {
+				part := reply[:min(len(reply), 4096)]
+				reply = reply[len(part):]
+				_ = writePacket(conn, id, packetResponse, part)
+				if reply == "" {
+					break
+				}
+			}
+		default:
+			_ = writePacket(conn, id, packetResponse, "Unknown request 0")
+		}
+	}
+}
+
+func TestExecute(t *testing.T) {
+	long := strings.Repeat("There are 3 of a max of 20 players online. ", 300)
+	addr := newFakeServer(t, map[string]string{
+		"list":       "There are 0 of a max of 20 players online: ",
+		"save-off":   "",
+		"help":       long,
+		"exact 4096": strings.Repeat("x", 4096),
+	})
+
+	conn, err := Dial(addr, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	tests := []struct {
+		command string
+		want    string
+	}{
+		{"list", "There are 0 of a max of 20 players online: "},
+		{"save-off", ""},
+		{"help", long},
+		{"exact 4096", strings.Repeat("x", 4096)},
+		// the connection is still in step after a split reply
+		{"list", "There are 0 of a max of 20 players online: "},
+	}
+	for _, tt := range tests {
+		got, err := conn.Execute(tt.command)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.command, err)
+		}
+		if got != tt.want {
+			t.Fatalf("%s: got a %d byte reply, want %d bytes", tt.command, len(got), len(tt.want))
+		}
+	}
+}
+
+func TestDialWrongPassword(t *testing.T) {
+	addr := newFakeServer(t, nil)
+
+	if _, err := Dial(addr, "wrong"); !errors.Is(err, ErrAuthFailed) {
+		t.Fatalf("got %v, want %v", err, ErrAuthFailed)
+	}
+}
+
+func TestCommand(t *testing.T) {
+	addr := newFakeServer(t, map[string]string{"list": "There are 0 of a max of 20 players online: "})
+
+	t.Setenv("RCON_PASSWORD", "")
+	if _, err := Command("list"); !errors.Is(err, ErrNotConfigured) {
+		t.Fatalf("got %v, want %v", err, ErrNotConfigured)
+	}
+
+	t.Setenv("RCON_PASSWORD", testPassword)
+	t.Setenv("RCON_ADDR", addr)
+	if got, err := Command("list"); err != nil || got != "There are 0 of a max of 20 players online: " {
+		t.Fatalf("got %q, %v", got, err)
+	}
+}
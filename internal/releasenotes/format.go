@@ -0,0 +1,255 @@
+package releasenotes
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/vnxcius/mcpanel-back/internal/logging"
+)
+
+// Discord rejects embeds past these limits
+const (
+	discordMaxEmbeds     = 10
+	discordMaxFields     = 25
+	discordMaxFieldValue = 1024
+	discordMaxTotal      = 6000
+)
+
+const (
+	colorAdded   = 0x57f287
+	colorRemoved = 0xed4245
+	colorUpdated = 0xfee75c
+)
+
+type DiscordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+type DiscordEmbed struct {
+	Title  string         `json:"title,omitempty"`
+	Color  int            `json:"color"`
+	Fields []DiscordField `json:"fields"`
+}
+
+// DiscordMessage is the body of a Discord webhook POST
+type DiscordMessage struct {
+	Embeds []DiscordEmbed `json:"embeds"`
+}
+
+/*
+Renders release notes as Markdown, one section per day.
+*/
+func Markdown(title string, days []Day) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n", title)
+
+	if len(days) == 0 {
+		b.WriteString("\nNo changes.\n")
+		return b.String()
+	}
+
+	for _, d := range days {
+		fmt.Fprintf(&b, "\n## %s\n", d.Date)
+		for _, section := range sections(d) {
+			if len(section.changes) == 0 {
+				continue
+			}
+			fmt.Fprintf(&b, "\n### %s\n", section.title)
+			for _, c := range section.changes {
+				fmt.Fprintf(&b, "- %s\n", describe(c, "`"))
+			}
+		}
+	}
+
+	return b.String()
+}
+
+/*
+Renders release notes as Discord embeds ready to be posted to a webhook.
+Each day and change type becomes a field, split over several fields and
+embeds when it does not fit Discord's limits.
+*/
+func Discord(title string, days []Day) DiscordMessage {
+	msg := DiscordMessage{Embeds: []DiscordEmbed{}}
+	total := 0
+
+	embed := DiscordEmbed{Title: title, Color: colorUpdated, Fields: []DiscordField{}}
+	total += len(title)
+
+	flush := func() {
+		if len(embed.Fields) > 0 {
+			msg.Embeds = append(msg.Embeds, embed)
+		}
+		embed = DiscordEmbed{Color: colorUpdated, Fields: []DiscordField{}}
+	}
+
+	for _, d := range days {
+		for _, section := range sections(d) {
+			lines := make([]string, len(section.changes))
+			for i, c := range section.changes {
+				lines[i] = "• " + describe(c, "`")
+			}
+
+			for i, value := range chunk(lines, discordMaxFieldValue) {
+				name := d.Date + " · " + section.title
+				if i > 0 {
+					name += " (cont.)"
+				}
+
+				if total+len(name)+len(value) > discordMaxTotal {
+					flush()
+					return truncated(msg)
+				}
+				if len(embed.Fields) == discordMaxFields {
+					flush()
+					if len(msg.Embeds) == discordMaxEmbeds {
+						return truncated(msg)
+					}
+				}
+
+				embed.Fields = append(embed.Fields, DiscordField{Name: name, Value: value})
+				total += len(name) + len(value)
+			}
+		}
+	}
+
+	if len(msg.Embeds) == 0 && len(embed.Fields) == 0 {
+		embed.Fields = append(embed.Fields, DiscordField{Name: "​", Value: "No changes."})
+	}
+	flush()
+
+	if len(msg.Embeds) > 0 {
+		msg.Embeds[0].Color = embedColor(days)
+	}
+	return msg
+}
+
+/*
+Writes release notes as CSV with one row per mod.
+*/
+func CSV(w io.Writer, days []Day) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"date", "change", "old_name", "old_version", "new_name", "new_version"})
+
+	for _, d := range days {
+		for _, section := range sections(d) {
+			for _, c := range section.changes {
+				row := []string{d.Date, section.key, "", "", "", ""}
+				if c.Old != nil {
+					row[2], row[3] = c.Old.Name, c.Old.Version
+				}
+				if c.New != nil {
+					row[4], row[5] = c.New.Name, c.New.Version
+				}
+				if err := cw.Write(row); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+type section struct {
+	key     string
+	title   string
+	changes []Change
+}
+
+func sections(d Day) []section {
+	return []section{
+		{"added", "Added", d.Added},
+		{"removed", "Removed", d.Removed},
+		{"updated", "Updated", d.Updated},
+	}
+}
+
+func describe(c Change, quote string) string {
+	switch {
+	case c.Old == nil:
+		return fileLabel(c.New, quote)
+	case c.New == nil:
+		return fileLabel(c.Old, quote)
+	case c.Old.Version != "" && c.New.Version != "" && c.Old.Name != c.New.Name:
+		return fmt.Sprintf("%s%s%s %s → %s", quote, c.Old.Name, quote, c.Old.Version, c.New.Version)
+	default:
+		return fmt.Sprintf("%s → %s", fileLabel(c.Old, quote), fileLabel(c.New, quote))
+	}
+}
+
+func fileLabel(f *logging.ModFile, quote string) string {
+	if f.Version != "" {
+		return fmt.Sprintf("%s%s%s (%s)", quote, f.Name, quote, f.Version)
+	}
+	return quote + f.Name + quote
+}
+
+/*
+Joins lines into values of at most max bytes, cutting single lines that
+are longer than that.
+*/
+func chunk(lines []string, max int) []string {
+	var chunks []string
+	var current strings.Builder
+
+	for _, line := range lines {
+		if len(line) > max {
+			line = truncate(line, max)
+		}
+		if current.Len() > 0 && current.Len()+1+len(line) > max {
+			chunks = append(chunks, current.String())
+			current.Reset()
+		}
+		if current.Len() > 0 {
+			current.WriteByte('\n')
+		}
+		current.WriteString(line)
+	}
+	if current.Len() > 0 {
+		chunks = append(chunks, current.String())
+	}
+	return chunks
+}
+
+func truncate(s string, max int) string {
+	const ellipsis = "…"
+	s = s[:max-len(ellipsis)]
+	for !utf8.ValidString(s) {
+		s = s[:len(s)-1]
+	}
+	return s + ellipsis
+}
+
+func truncated(msg DiscordMessage) DiscordMessage {
+	if len(msg.Embeds) > 0 {
+		last := &msg.Embeds[len(msg.Embeds)-1]
+		if len(last.Fields) > 0 {
+			last.Fields = last.Fields[:len(last.Fields)-1]
+		}
+		last.Fields = append(last.Fields, DiscordField{Name: "​", Value: "Too many changes, use the Markdown export for the full list."})
+	}
+	return msg
+}
+
+func embedColor(days []Day) int {
+	var added, removed int
+	for _, d := range days {
+		added += len(d.Added)
+		removed += len(d.Removed)
+	}
+	switch {
+	case added > 0 && removed == 0:
+		return colorAdded
+	case removed > 0 && added == 0:
+		return colorRemoved
+	default:
+		return colorUpdated
+	}
+}
@@ -0,0 +1,149 @@
+package releasenotes
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/vnxcius/mcpanel-back/internal/logging"
+)
+
+/*
+Change is the net effect of a range of changelog entries on one mod.
+Old is nil for mods added in the range, New is nil for removed ones.
+*/
+type Change struct {
+	Old *logging.ModFile `json:"old,omitempty"`
+	New *logging.ModFile `json:"new,omitempty"`
+}
+
+type Day struct {
+	Date    string   `json:"date"`
+	Added   []Change `json:"added"`
+	Removed []Change `json:"removed"`
+	Updated []Change `json:"updated"`
+}
+
+type net struct {
+	before *logging.ModFile
+	after  *logging.ModFile
+	day    string
+	order  int
+}
+
+/*
+Collapses changelog entries into per-day release notes. Entries must be
+oldest first. A mod's changes are folded together following renames, so an
+add followed by a delete disappears and add then update shows as a single
+addition of the final file. Disabling a mod is logged as its deletion and
+enabling it as an addition, so a mod disabled and enabled again drops out
+too. Each mod is listed on the day of its last change.
+*/
+func Build(entries []logging.ModChangeEntry, loc *time.Location) []Day {
+	current := map[string]*net{}
+	var all []*net
+
+	track := func(name string, before *logging.ModFile) *net {
+		n := &net{before: before}
+		all = append(all, n)
+		current[name] = n
+		return n
+	}
+
+	for i, e := range entries {
+		e = e.Normalized()
+
+		var n *net
+		switch e.Type {
+		case logging.ModAdded:
+			name := fileName(e.New, e.Name)
+			if n = current[name]; n == nil {
+				n = track(name, nil)
+			}
+			n.after = e.New
+		case logging.ModUpdated:
+			oldName := fileName(e.Old, "")
+			if n = current[oldName]; n == nil {
+				n = track(oldName, e.Old)
+			}
+			delete(current, oldName)
+			current[fileName(e.New, e.Name)] = n
+			n.after = e.New
+		case logging.ModDeleted:
+			name := fileName(e.Old, e.Name)
+			if n = current[name]; n == nil {
+				n = track(name, e.Old)
+			}
+			n.after = nil
+		default:
+			continue
+		}
+
+		n.day = day(e.Time, loc)
+		n.order = i
+	}
+
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].order < all[j].order
+	})
+
+	days := []Day{}
+	byDate := map[string]int{}
+	for _, n := range all {
+		if n.before == nil && n.after == nil {
+			continue
+		}
+		if n.before != nil && n.after != nil && sameFile(n.before, n.after) {
+			continue
+		}
+
+		idx, ok := byDate[n.day]
+		if !ok {
+			days = append(days, Day{Date: n.day, Added: []Change{}, Removed: []Change{}, Updated: []Change{}})
+			idx = len(days) - 1
+			byDate[n.day] = idx
+		}
+
+		change := Change{Old: n.before, New: n.after}
+		switch {
+		case n.before == nil:
+			days[idx].Added = append(days[idx].Added, change)
+		case n.after == nil:
+			days[idx].Removed = append(days[idx].Removed, change)
+		default:
+			days[idx].Updated = append(days[idx].Updated, change)
+		}
+	}
+
+	sort.Slice(days, func(i, j int) bool {
+		return days[i].Date < days[j].Date
+	})
+
+	return days
+}
+
+/*
+Names the mod a file belongs to. A disabled jar keeps its name with a
+.disabled suffix, it is the same mod.
+*/
+func fileName(f *logging.ModFile, fallback string) string {
+	if f != nil {
+		fallback = f.Name
+	}
+	return strings.TrimSuffix(fallback, ".disabled")
+}
+
+func sameFile(a, b *logging.ModFile) bool {
+	if a.SHA256 != "" && b.SHA256 != "" {
+		return a.SHA256 == b.SHA256
+	}
+	return a.Name == b.Name
+}
+
+func day(t string, loc *time.Location) string {
+	parsed, err := time.Parse(time.RFC3339, t)
+	if err != nil {
+		return "unknown"
+	}
+	return parsed.In(loc).Format(time.DateOnly)
+}
@@ -0,0 +1,187 @@
+package releasenotes
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vnxcius/mcpanel-back/internal/logging"
+)
+
+func mod(name, sha string) *logging.ModFile {
+	return &logging.ModFile{Name: name, SHA256: sha}
+}
+
+func added(at string, f *logging.ModFile) logging.ModChangeEntry {
+	return logging.ModChangeEntry{Time: at, Type: logging.ModAdded, Name: f.Name, New: f}
+}
+
+func deleted(at string, f *logging.ModFile) logging.ModChangeEntry {
+	return logging.ModChangeEntry{Time: at, Type: logging.ModDeleted, Name: f.Name, Old: f}
+}
+
+func updated(at string, old, new *logging.ModFile) logging.ModChangeEntry {
+	return logging.ModChangeEntry{Time: at, Type: logging.ModUpdated, Name: new.Name, Old: old, New: new}
+}
+
+func noteDay(date string, added, removed, updated []Change) Day {
+	d := Day{Date: date, Added: []Change{}, Removed: []Change{}, Updated: []Change{}}
+	d.Added = append(d.Added, added...)
+	d.Removed = append(d.Removed, removed...)
+	d.Updated = append(d.Updated, updated...)
+	return d
+}
+
+func TestBuild(t *testing.T) {
+	const (
+		june1 = "2024-06-01T10:00:00Z"
+		june2 = "2024-06-02T10:00:00Z"
+		june3 = "2024-06-03T10:00:00Z"
+	)
+	jei1 := mod("jei-1.0.jar", "aaa")
+	jei2 := mod("jei-2.0.jar", "bbb")
+	jei3 := mod("jei-3.0.jar", "ccc")
+	ae2 := mod("ae2.jar", "ddd")
+	create := mod("create.jar", "eee")
+
+	tests := []struct {
+		name    string
+		entries []logging.ModChangeEntry
+		want    []Day
+	}{
+		{
+			name: "no entries",
+			want: []Day{},
+		},
+		{
+			name:    "one of each",
+			entries: []logging.ModChangeEntry{added(june1, ae2), deleted(june1, create), updated(june1, jei1, jei2)},
+			want: []Day{noteDay("2024-06-01",
+				[]Change{{New: ae2}},
+				[]Change{{Old: create}},
+				[]Change{{Old: jei1, New: jei2}},
+			)},
+		},
+		{
+			name:    "added then deleted",
+			entries: []logging.ModChangeEntry{added(june1, ae2), deleted(june2, ae2)},
+			want:    []Day{},
+		},
+		{
+			name:    "added then updated",
+			entries: []logging.ModChangeEntry{added(june1, jei1), updated(june2, jei1, jei2)},
+			want:    []Day{noteDay("2024-06-02", []Change{{New: jei2}}, nil, nil)},
+		},
+		{
+			name:    "updates follow renames",
+			entries: []logging.ModChangeEntry{updated(june1, jei1, jei2), updated(june2, jei2, jei3)},
+			want:    []Day{noteDay("2024-06-02", nil, nil, []Change{{Old: jei1, New: jei3}})},
+		},
+		{
+			name:    "updated back to the same file",
+			entries: []logging.ModChangeEntry{updated(june1, jei1, jei2), updated(june2, jei2, jei1)},
+			want:    []Day{},
+		},
+		{
+			name:    "deleted and added back",
+			entries: []logging.ModChangeEntry{deleted(june1, ae2), added(june2, ae2)},
+			want:    []Day{},
+		},
+		{
+			name:    "deleted then added as a new version",
+			entries: []logging.ModChangeEntry{deleted(june1, jei1), added(june2, jei2)},
+			want: []Day{
+				noteDay("2024-06-01", nil, []Change{{Old: jei1}}, nil),
+				noteDay("2024-06-02", []Change{{New: jei2}}, nil, nil),
+			},
+		},
+		{
+			name:    "listed on the day of the last change, days in order",
+			entries: []logging.ModChangeEntry{added(june1, ae2), deleted(june1, create), added(june3, jei1), updated(june2, jei1, jei2)},
+			want: []Day{
+				noteDay("2024-06-01", []Change{{New: ae2}}, []Change{{Old: create}}, nil),
+				noteDay("2024-06-02", []Change{{New: jei2}}, nil, nil),
+			},
+		},
+		{
+			name: "entries without files",
+			entries: []logging.ModChangeEntry{
+				{Time: june1, Type: logging.ModAdded, Name: "ae2.jar"},
+				{Time: june1, Type: logging.ModUpdated, Name: "jei-1.0.jar → jei-2.0.jar"},
+			},
+			want: []Day{noteDay("2024-06-01",
+				[]Change{{New: mod("ae2.jar", "")}},
+				nil,
+				[]Change{{Old: mod("jei-1.0.jar", ""), New: mod("jei-2.0.jar", "")}},
+			)},
+		},
+		{
+			name:    "disabled",
+			entries: []logging.ModChangeEntry{deleted(june1, ae2)},
+			want:    []Day{noteDay("2024-06-01", nil, []Change{{Old: ae2}}, nil)},
+		},
+		{
+			name:    "enabled",
+			entries: []logging.ModChangeEntry{added(june1, ae2)},
+			want:    []Day{noteDay("2024-06-01", []Change{{New: ae2}}, nil, nil)},
+		},
+		{
+			name:    "disabled and enabled again",
+			entries: []logging.ModChangeEntry{deleted(june1, ae2), added(june2, ae2)},
+			want:    []Day{},
+		},
+		{
+			name:    "added then disabled",
+			entries: []logging.ModChangeEntry{added(june1, ae2), deleted(june2, ae2)},
+			want:    []Day{},
+		},
+		{
+			name:    "disabled then deleted",
+			entries: []logging.ModChangeEntry{deleted(june1, ae2), deleted(june2, mod("ae2.jar.disabled", "ddd"))},
+			want:    []Day{noteDay("2024-06-02", nil, []Change{{Old: ae2}}, nil)},
+		},
+		{
+			name:    "disabled jar replaced, then enabled",
+			entries: []logging.ModChangeEntry{deleted(june1, jei1), updated(june2, mod("jei-1.0.jar.disabled", "aaa"), mod("jei-2.0.jar.disabled", "bbb")), added(june3, jei2)},
+			want:    []Day{noteDay("2024-06-03", nil, nil, []Change{{Old: jei1, New: jei2}})},
+		},
+		{
+			name:    "unparseable time",
+			entries: []logging.ModChangeEntry{added("yesterday", ae2)},
+			want:    []Day{noteDay("unknown", []Change{{New: ae2}}, nil, nil)},
+		},
+		{
+			name:    "unknown type",
+			entries: []logging.ModChangeEntry{{Time: june1, Type: "renamed", Name: "ae2.jar", New: ae2}},
+			want:    []Day{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Build(tt.entries, time.UTC)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildUsesTheLocationForDays(t *testing.T) {
+	entries := []logging.ModChangeEntry{added("2024-06-01T23:30:00Z", mod("ae2.jar", "ddd"))}
+
+	tests := []struct {
+		offset int
+		want   string
+	}{
+		{-3, "2024-06-01"},
+		{0, "2024-06-01"},
+		{3, "2024-06-02"},
+	}
+	for _, tt := range tests {
+		loc := time.FixedZone("", tt.offset*60*60)
+		if days := Build(entries, loc); len(days) != 1 || days[0].Date != tt.want {
+			t.Errorf("UTC%+d: got %+v, want %s", tt.offset, days, tt.want)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package utils
+
+import (
+	"archive/zip"
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/vnxcius/mcpanel-back/internal/logging"
+)
+
+var fileNameVersion = regexp.MustCompile(`[-_+ ]v?(\d+(?:\.\d+)+[\w.+-]*?)\.jar$`)
+
+/*
+Returns the name, size, SHA-256 and version of a mod jar. The version comes
+from the loader metadata inside the jar when there is one, falling back to
+the version in the file name.
+*/
+func ReadModFile(path string) (logging.ModFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return logging.ModFile{}, err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return logging.ModFile{}, err
+	}
+
+	name := filepath.Base(path)
+	version := jarVersion(path)
+	if version == "" {
+		if m := fileNameVersion.FindStringSubmatch(name); m != nil {
+			version = m[1]
+		}
+	}
+
+	return logging.ModFile{
+		Name:    name,
+		Size:    size,
+		SHA256:  hex.EncodeToString(hash.Sum(nil)),
+		Version: version,
+	}, nil
+}
+
+func jarVersion(path string) string {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return ""
+	}
+	defer zr.Close()
+
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	for _, name := range []string{"META-INF/neoforge.mods.toml", "META-INF/mods.toml"} {
+		if f, ok := files[name]; ok {
+			var meta struct {
+				Mods []struct {
+					Version string `toml:"version"`
+				} `toml:"mods"`
+			}
+			if err := decodeZipFile(f, func(data []byte) error {
+				return toml.Unmarshal(data, &meta)
+			}); err != nil || len(meta.Mods) == 0 {
+				continue
+			}
+
+			version := meta.Mods[0].Version
+			// Forge fills this in from the manifest at runtime
+			if strings.Contains(version, "${") {
+				version = manifestVersion(files["META-INF/MANIFEST.MF"])
+			}
+			return version
+		}
+	}
+
+	if f, ok := files["fabric.mod.json"]; ok {
+		var meta struct {
+			Version string `json:"version"`
+		}
+		if decodeZipFile(f, func(data []byte) error {
+			return json.Unmarshal(data, &meta)
+		}) == nil {
+			return meta.Version
+		}
+	}
+
+	if f, ok := files["quilt.mod.json"]; ok {
+		var meta struct {
+			Loader struct {
+				Version string `json:"version"`
+			} `json:"quilt_loader"`
+		}
+		if decodeZipFile(f, func(data []byte) error {
+			return json.Unmarshal(data, &meta)
+		}) == nil {
+			return meta.Loader.Version
+		}
+	}
+
+	return ""
+}
+
+func manifestVersion(f *zip.File) string {
+	if f == nil {
+		return ""
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return ""
+	}
+	defer rc.Close()
+
+	scanner := bufio.NewScanner(rc)
+	for scanner.Scan() {
+		if v, ok := strings.CutPrefix(scanner.Text(), "Implementation-Version:"); ok {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
+
+func decodeZipFile(f *zip.File, decode func([]byte) error) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, 1<<20))
+	if err != nil {
+		return err
+	}
+	return decode(data)
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/fs"
 	"log/slog"
 	"mime/multipart"
 	"net"
@@ -25,10 +26,14 @@ type mod struct {
 	Name    string `json:"name"`
 	Size    int64  `json:"size"`
 	ModTime int64  `json:"modTime"`
+	Enabled bool   `json:"enabled"`
 }
 
 const addr = "localhost:25565"
 
+// disabled mods keep their jar with this suffix so the loader skips them
+const disabledSuffix = ".disabled"
+
 /*
 Returns the list of mods in the mods folder.
 */
@@ -44,8 +49,9 @@ func GetMods() ([]byte, error) {
 	var mods []mod = []mod{}
 
 	for _, e := range entries {
-		// only add .jar files to the list
-		if !e.IsDir() && strings.EqualFold(filepath.Ext(e.Name()), ".jar") {
+		// only add .jar files to the list, enabled or not
+		jar := strings.TrimSuffix(e.Name(), disabledSuffix)
+		if !e.IsDir() && strings.EqualFold(filepath.Ext(jar), ".jar") {
 			info, err := os.Stat(filepath.Join(path, e.Name()))
 			if err != nil {
 				continue
@@ -54,6 +60,7 @@ func GetMods() ([]byte, error) {
 				Name:    info.Name(),
 				Size:    info.Size(),
 				ModTime: info.ModTime().Unix(),
+				Enabled: jar == e.Name(),
 			})
 		}
 
@@ -141,6 +148,40 @@ func DeleteModFromDir(modsDir, modName string) error {
 	return nil
 }
 
+/*
+Enables or disables a mod by adding or removing the .disabled suffix of
+its jar. name may be given with or without the suffix. Returns the old
+and new file names; old is empty if the mod was already in the wanted
+state and nothing was done.
+*/
+func SetModEnabled(modsDir, name string, enabled bool) (string, string, error) {
+	if name == "" || strings.Contains(name, "..") || strings.ContainsAny(name, `/\`) {
+		return "", "", errors.New("invalid mod name")
+	}
+
+	jar := strings.TrimSuffix(name, disabledSuffix)
+	if !strings.EqualFold(filepath.Ext(jar), ".jar") {
+		return "", "", errors.New("invalid mod name")
+	}
+
+	from, to := jar+disabledSuffix, jar
+	if !enabled {
+		from, to = jar, jar+disabledSuffix
+	}
+
+	if _, err := os.Stat(filepath.Join(modsDir, to)); err == nil {
+		return "", to, nil
+	}
+	if err := os.Rename(filepath.Join(modsDir, from), filepath.Join(modsDir, to)); err != nil {
+		if os.IsNotExist(err) {
+			return "", "", errors.New("mod not found")
+		}
+		return "", "", err
+	}
+
+	return from, to, nil
+}
+
 type skippedFile struct {
 	File   string `json:"file"`
 	Reason string `json:"reason"`
@@ -237,20 +278,71 @@ func UpdateModFromDir(
 	return nil
 }
 
-func GetModlistChangelog() ([]map[string]any, error) {
-	const logDir = "./logs/modlist-changelog"
+/*
+Writes data to a temporary file next to path and renames it into place, so
+readers never see a half written file. Keeps the permissions of the file
+being replaced.
+*/
+func WriteFileAtomic(path string, data []byte) error {
+	mode := fs.FileMode(0o644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".mcpanel-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
 
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func GetConfigChangelog() ([]map[string]any, error) {
+	return readChangelogMaps("./logs/config-changelog")
+}
+
+func GetPlayerListChangelog() ([]map[string]any, error) {
+	return readChangelogMaps("./logs/playerlist-changelog")
+}
+
+func readChangelogMaps(logDir string) ([]map[string]any, error) {
+	changes := []map[string]any{}
+	err := readChangelogDir(logDir, func(line []byte) {
+		var entry map[string]any
+		if err := json.Unmarshal(line, &entry); err == nil {
+			changes = append(changes, entry)
+		}
+	})
+	return changes, err
+}
+
+/*
+Calls fn with every line of the daily JSONL files in a changelog directory,
+newest file first.
+*/
+func readChangelogDir(logDir string, fn func(line []byte)) error {
 	files, err := os.ReadDir(logDir)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read changelog dir: %w", err)
+		return fmt.Errorf("failed to read changelog dir: %w", err)
 	}
 
 	sort.Slice(files, func(i, j int) bool {
 		return files[i].Name() > files[j].Name()
 	})
 
-	var allChanges []map[string]any
-
 	for _, file := range files {
 		if file.IsDir() || !strings.HasSuffix(file.Name(), ".log") {
 			continue
@@ -264,13 +356,10 @@ func GetModlistChangelog() ([]map[string]any, error) {
 
 		scanner := bufio.NewScanner(f)
 		for scanner.Scan() {
-			var entry map[string]any
-			if err := json.Unmarshal([]byte(scanner.Text()), &entry); err == nil {
-				allChanges = append(allChanges, entry)
-			}
+			fn(scanner.Bytes())
 		}
 		f.Close()
 	}
 
-	return allChanges, nil
+	return nil
 }